@@ -1,25 +1,174 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"go.uber.org/zap"
 	"log"
+	"mystore/internal/auth"
 	"mystore/internal/config"
 	"mystore/internal/handlers"
+	"mystore/internal/payment"
 	"mystore/internal/repository"
 	"mystore/internal/routes"
 	"mystore/internal/service"
+	"mystore/internal/storage"
+	"os"
+	"time"
 )
 
-func InitApp(db *sql.DB, logger *zap.Logger) (*handlers.UserHandler, *handlers.ProductHandler) {
+const (
+	reservationTTL           = 15 * time.Minute
+	reservationSweepInterval = time.Minute
+	signingKeyCheckInterval  = time.Minute
+)
+
+func InitApp(ctx context.Context, db *sql.DB, logger *zap.Logger) (*handlers.UserHandler, *handlers.ProductHandler, *handlers.OrderHandler, *handlers.CartHandler, *handlers.WebhookHandler, *handlers.CategoryHandler, *handlers.FeedHandler, repository.IdempotencyRepository, repository.TokenRepository, *auth.KeyManager, *handlers.KeyHandler, *handlers.RoleHandler) {
 	productRepo := repository.NewProductRepo(db, logger)
-	productService := service.NewProductService(productRepo, logger)
-	productHandler := handlers.NewProductHandler(productService)
+	variantRepo := repository.NewVariantRepository(db, productRepo, logger)
+	mediaStore, err := storage.NewLocalStore(mediaDir())
+	if err != nil {
+		logger.Fatal("failed to configure media storage", zap.Error(err))
+	}
+	imageService := service.NewImageService(repository.NewImageRepository(db, logger), mediaStore, logger)
+	productService := service.NewProductService(productRepo, variantRepo, imageService, logger)
+	productHandler := handlers.NewProductHandler(productService, imageService, mediaStore)
+
+	feedConfig, err := productFeedConfig()
+	if err != nil {
+		logger.Fatal("failed to configure product feed", zap.Error(err))
+	}
+	feedHandler := handlers.NewFeedHandler(service.NewFeedService(productRepo, imageService, feedConfig, logger))
+
+	categoryRepo := repository.NewCategoryRepository(db, logger)
+	categoryService := service.NewCategoryService(categoryRepo, logger)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+
+	reservationRepo := repository.NewReservationRepository(db, productRepo, reservationTTL, logger)
+	orderRepo := repository.NewOrderRepository(db, productRepo, reservationRepo, logger)
+	paymentRepo := repository.NewPaymentRepository(db, logger)
+	paymentProvider, err := newPaymentProvider()
+	if err != nil {
+		logger.Fatal("failed to configure payment provider", zap.Error(err))
+	}
+	orderService := service.NewOrderService(orderRepo, reservationRepo, paymentRepo, paymentProvider, logger)
+	orderHandler := handlers.NewOrderHandler(orderService)
+	go orderService.RunReservationSweeper(ctx, reservationSweepInterval)
+
+	webhookService := service.NewPaymentWebhookService(orderService, paymentRepo, paymentProvider.Name(), logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, []byte(os.Getenv("PAYMENT_WEBHOOK_SECRET")))
+
+	cartRepo := repository.NewCartRepository(db, logger)
+	cartService := service.NewCartService(cartRepo, productRepo, orderService, logger)
+	cartHandler := handlers.NewCartHandler(cartService)
 
 	userRepo := repository.NewUserRepository(db, logger)
-	userService := service.NewUserService(userRepo, logger)
-	userHandler := handlers.NewUserHandler(userService)
-	return userHandler, productHandler
+	keyConfig, err := signingKeyConfig()
+	if err != nil {
+		logger.Fatal("failed to configure token signing keys", zap.Error(err))
+	}
+	jwtKeys, err := auth.NewKeyManager(keyConfig, logger)
+	if err != nil {
+		logger.Fatal("failed to configure token signing keys", zap.Error(err))
+	}
+	go jwtKeys.Run(ctx, signingKeyCheckInterval)
+	keyHandler := handlers.NewKeyHandler(jwtKeys)
+
+	tokenRepo := repository.NewTokenRepository(db, service.AccessTokenTTL, service.RefreshTokenTTL, logger)
+	roleRepo := repository.NewRoleRepository(db, logger)
+	roleHandler := handlers.NewRoleHandler(service.NewRoleService(roleRepo, logger))
+	tokenService := service.NewTokenService(tokenRepo, userRepo, roleRepo, jwtKeys, logger)
+	userService := service.NewUserService(userRepo, roleRepo, tokenService, logger)
+	userHandler := handlers.NewUserHandler(userService, cartService, tokenService)
+
+	idempotencyRepo := repository.NewIdempotencyRepository(db, logger)
+	return userHandler, productHandler, orderHandler, cartHandler, webhookHandler, categoryHandler, feedHandler, idempotencyRepo, tokenRepo, jwtKeys, keyHandler, roleHandler
+}
+
+// mediaDir is where uploaded product images are kept, MEDIA_DIR or ./media.
+func mediaDir() string {
+	if dir := os.Getenv("MEDIA_DIR"); dir != "" {
+		return dir
+	}
+	return "media"
+}
+
+// productFeedConfig reads the product feed settings: FEED_BASE_URL, the
+// public address links in the feed point to; FEED_CURRENCY, an ISO 4217 code
+// (USD by default); and FEED_CACHE_TTL, how long a rendered feed is reused
+// (15m by default).
+func productFeedConfig() (service.FeedConfig, error) {
+	config := service.FeedConfig{
+		Title:       "MyStore",
+		Description: "MyStore product catalog",
+		BaseURL:     os.Getenv("FEED_BASE_URL"),
+		Currency:    os.Getenv("FEED_CURRENCY"),
+		TTL:         15 * time.Minute,
+	}
+	if config.BaseURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		config.BaseURL = "http://localhost:" + port
+	}
+	if config.Currency == "" {
+		config.Currency = "USD"
+	}
+	if len(config.Currency) != 3 {
+		return config, fmt.Errorf("FEED_CURRENCY must be a three-letter currency code, got %q", config.Currency)
+	}
+	if ttl := os.Getenv("FEED_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("invalid FEED_CACHE_TTL %q", ttl)
+		}
+		config.TTL = d
+	}
+	return config, nil
+}
+
+// signingKeyConfig reads the token signing settings: JWT_SIGNING_ALG (EdDSA,
+// RS256 or HS256; EdDSA by default), JWT_KEYS_DIR where keys are persisted,
+// and JWT_KEY_ROTATION, how long each key signs (720h by default). JWT_KEY,
+// the former single HMAC secret, only verifies tokens issued before the
+// upgrade.
+func signingKeyConfig() (auth.KeyConfig, error) {
+	config := auth.KeyConfig{
+		Algorithm:    os.Getenv("JWT_SIGNING_ALG"),
+		Dir:          os.Getenv("JWT_KEYS_DIR"),
+		RotateEvery:  30 * 24 * time.Hour,
+		VerifyFor:    service.AccessTokenTTL,
+		LegacySecret: []byte(os.Getenv("JWT_KEY")),
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = auth.AlgEdDSA
+	}
+	if rotation := os.Getenv("JWT_KEY_ROTATION"); rotation != "" {
+		d, err := time.ParseDuration(rotation)
+		if err != nil {
+			return config, fmt.Errorf("invalid JWT_KEY_ROTATION %q", rotation)
+		}
+		config.RotateEvery = d
+	}
+	return config, nil
+}
+
+// newPaymentProvider builds the payment gateway selected by PAYMENT_PROVIDER.
+// Only the in-process fake exists so far; PAYMENT_FAKE_MODE picks whether it
+// succeeds, declines or times out.
+func newPaymentProvider() (payment.PaymentProvider, error) {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "", "fake":
+		mode, err := payment.ParseFakeMode(os.Getenv("PAYMENT_FAKE_MODE"))
+		if err != nil {
+			return nil, err
+		}
+		return payment.NewFakeProvider(mode), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
 }
 
 func Run() {
@@ -45,9 +194,12 @@ func Run() {
 		}
 	}(logger)
 
-	userHandler, productHandler := InitApp(db, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userHandler, productHandler, orderHandler, cartHandler, webhookHandler, categoryHandler, feedHandler, idempotencyRepo, tokenRepo, jwtKeys, keyHandler, roleHandler := InitApp(ctx, db, logger)
 
-	r := routes.SetupRoutes(userHandler, productHandler)
+	r := routes.SetupRoutes(userHandler, productHandler, orderHandler, cartHandler, webhookHandler, categoryHandler, feedHandler, idempotencyRepo, tokenRepo, jwtKeys, keyHandler, roleHandler)
 
 	if err := r.Run(); err != nil {
 		log.Fatal("failed to run server")
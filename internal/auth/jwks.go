@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"time"
+)
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	ID        string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys other services need to verify tokens: the
+// current key, the next one if it is already published, and retired keys
+// still inside their verification window. HS256 keys are shared secrets and
+// are never published, so HS256 tokens can only be verified by MyStore.
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for i, key := range m.keys {
+		if !m.verifies(i, now) {
+			continue
+		}
+		jwk := JWK{Use: "sig", Algorithm: key.Algorithm, ID: key.ID}
+		switch public := key.verificationKey().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
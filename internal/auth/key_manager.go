@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// publishAhead is how long a new key is listed in the JWKS before it starts
+// signing, so services that cache the JWKS already know it by then.
+const publishAhead = 10 * time.Minute
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeyConfig configures a KeyManager.
+type KeyConfig struct {
+	// Algorithm signs new keys: AlgEdDSA, AlgRS256 or AlgHS256.
+	Algorithm string
+	// Dir keeps the keys as PEM files so they survive restarts and can be
+	// shared by several instances. Keys are kept in memory only when empty.
+	Dir string
+	// RotateEvery is how long a key signs before a new one takes over.
+	RotateEvery time.Duration
+	// VerifyFor is how long a key still verifies tokens after it stopped
+	// signing; it must cover the longest token lifetime.
+	VerifyFor time.Duration
+	// LegacySecret is the old single HS256 key. Tokens without a kid are
+	// verified with it for VerifyFor after start-up; it never signs.
+	LegacySecret []byte
+}
+
+// KeyManager signs tokens with the current key and verifies them with any key
+// that is still within its verification window. Keys are rotated on a
+// schedule by Run.
+type KeyManager struct {
+	config      KeyConfig
+	legacyUntil time.Time
+	logger      *zap.Logger
+
+	mu   sync.RWMutex
+	keys []*Key // sorted by NotBefore
+}
+
+func NewKeyManager(config KeyConfig, logger *zap.Logger) (*KeyManager, error) {
+	if config.RotateEvery <= publishAhead {
+		return nil, fmt.Errorf("key rotation interval must exceed %s", publishAhead)
+	}
+	switch config.Algorithm {
+	case AlgEdDSA, AlgRS256, AlgHS256:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", config.Algorithm)
+	}
+	if config.Dir != "" {
+		if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+			return nil, err
+		}
+	} else {
+		logger.Warn("JWT signing keys are not persisted; tokens will not survive a restart")
+	}
+
+	m := &KeyManager{config: config, logger: logger}
+	if len(config.LegacySecret) > 0 {
+		m.legacyUntil = time.Now().Add(config.VerifyFor)
+	}
+	if err := m.Refresh(time.Now()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Sign signs claims with the current key and names it in the kid header.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.current(time.Now())
+	m.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("no signing key is active")
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signingKey())
+}
+
+// Keyfunc picks the verification key for a token by its kid header, for use
+// with jwt.Parse. Tokens without a kid are only accepted with the legacy
+// secret during its grace period.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if len(m.config.LegacySecret) == 0 || time.Now().After(m.legacyUntil) {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != AlgHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return m.config.LegacySecret, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	for i, key := range m.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.NotBefore.After(now) || !m.verifies(i, now) {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.verificationKey(), nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// ValidMethods lists the algorithms Keyfunc can return keys for, to pass to
+// jwt.WithValidMethods.
+func (m *KeyManager) ValidMethods() []string {
+	return []string{AlgEdDSA, AlgRS256, AlgHS256}
+}
+
+// Run refreshes the keys every interval until ctx is cancelled, picking up
+// keys written by other instances and rotating when the current key is due.
+func (m *KeyManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.Refresh(now); err != nil {
+				m.logger.Error("failed to refresh signing keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Refresh reloads the keys directory, drops keys past their verification
+// window and generates a key when none is signing or the next one is due.
+// A new key is published publishAhead before it starts signing.
+func (m *KeyManager) Refresh(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.config.Dir != "" {
+		loaded, err := loadKeys(m.config.Dir)
+		if err != nil {
+			return fmt.Errorf("load signing keys: %w", err)
+		}
+		m.merge(loaded)
+	}
+	m.prune(now)
+
+	current := m.current(now)
+	switch {
+	case current == nil:
+		return m.add(now)
+	case m.keys[len(m.keys)-1] == current && !now.Before(current.NotBefore.Add(m.config.RotateEvery-publishAhead)):
+		return m.add(now.Add(publishAhead))
+	}
+	return nil
+}
+
+// current returns the newest key that has started signing. Callers hold mu.
+func (m *KeyManager) current(now time.Time) *Key {
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if !m.keys[i].NotBefore.After(now) {
+			return m.keys[i]
+		}
+	}
+	return nil
+}
+
+// verifies reports whether keys[i] is still inside its verification window:
+// until VerifyFor after the next key started signing. Callers hold mu.
+func (m *KeyManager) verifies(i int, now time.Time) bool {
+	if i+1 == len(m.keys) {
+		return true
+	}
+	next := m.keys[i+1]
+	return next.NotBefore.After(now) || !now.After(next.NotBefore.Add(m.config.VerifyFor))
+}
+
+func (m *KeyManager) add(notBefore time.Time) error {
+	key, err := generateKey(m.config.Algorithm, notBefore)
+	if err != nil {
+		return fmt.Errorf("generate signing key: %w", err)
+	}
+	if m.config.Dir != "" {
+		if err := key.save(m.config.Dir); err != nil {
+			return fmt.Errorf("save signing key: %w", err)
+		}
+	}
+	m.merge([]*Key{key})
+	m.logger.Info("generated signing key", zap.String("kid", key.ID), zap.String("alg", key.Algorithm),
+		zap.Time("not_before", key.NotBefore))
+	return nil
+}
+
+// merge adds keys that are not known yet and keeps the list sorted.
+func (m *KeyManager) merge(keys []*Key) {
+	known := make(map[string]bool, len(m.keys))
+	for _, key := range m.keys {
+		known[key.ID] = true
+	}
+	for _, key := range keys {
+		if !known[key.ID] {
+			m.keys = append(m.keys, key)
+			known[key.ID] = true
+		}
+	}
+	sort.SliceStable(m.keys, func(i, j int) bool {
+		return m.keys[i].NotBefore.Before(m.keys[j].NotBefore)
+	})
+}
+
+// prune forgets keys past their verification window and removes their files.
+func (m *KeyManager) prune(now time.Time) {
+	kept := make([]*Key, 0, len(m.keys))
+	for i, key := range m.keys {
+		if m.verifies(i, now) {
+			kept = append(kept, key)
+			continue
+		}
+		if m.config.Dir != "" {
+			if err := os.Remove(keyPath(m.config.Dir, key.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				m.logger.Warn("failed to remove expired signing key", zap.String("kid", key.ID), zap.Error(err))
+			}
+		}
+	}
+	m.keys = kept
+}
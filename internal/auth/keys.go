@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+	AlgHS256 = "HS256"
+
+	rsaKeyBits   = 2048
+	hmacKeyBytes = 32
+
+	pemTypePrivateKey = "PRIVATE KEY"
+	pemTypeHMACSecret = "HMAC SECRET"
+)
+
+// Key is one signing key. HS256 keys hold a shared secret; EdDSA and RS256
+// keys hold a private key whose public half is published in the JWKS.
+// NotBefore is when the key starts signing tokens.
+type Key struct {
+	ID        string
+	Algorithm string
+	NotBefore time.Time
+	private   any
+}
+
+// generateKey creates a key for alg that starts signing at notBefore. The
+// kid leads with the activation time so key files sort chronologically.
+func generateKey(alg string, notBefore time.Time) (*Key, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:        notBefore.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Algorithm: alg,
+		NotBefore: notBefore,
+	}
+	switch alg {
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+	case AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+	case AlgHS256:
+		secret := make([]byte, hmacKeyBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		key.private = secret
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return key, nil
+}
+
+// signingKey is what jwt needs to sign with this key.
+func (k *Key) signingKey() any {
+	return k.private
+}
+
+// verificationKey is what jwt needs to verify a signature made with this key.
+func (k *Key) verificationKey() any {
+	switch private := k.private.(type) {
+	case ed25519.PrivateKey:
+		return private.Public()
+	case *rsa.PrivateKey:
+		return &private.PublicKey
+	default:
+		return private
+	}
+}
+
+// keyPath is where a key is kept inside the keys directory.
+func keyPath(dir, kid string) string {
+	return filepath.Join(dir, kid+".pem")
+}
+
+// save writes the key as PEM with its kid, algorithm and activation time in
+// the block headers. The file is written to a temporary name and renamed, so
+// another instance reading the directory never sees half a key.
+func (k *Key) save(dir string) error {
+	block := &pem.Block{
+		Headers: map[string]string{
+			"Kid":        k.ID,
+			"Algorithm":  k.Algorithm,
+			"Not-Before": k.NotBefore.UTC().Format(time.RFC3339),
+		},
+	}
+	if secret, ok := k.private.([]byte); ok {
+		block.Type, block.Bytes = pemTypeHMACSecret, secret
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(k.private)
+		if err != nil {
+			return err
+		}
+		block.Type, block.Bytes = pemTypePrivateKey, der
+	}
+
+	tmp, err := os.CreateTemp(dir, ".key-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := pem.Encode(tmp, block); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), keyPath(dir, k.ID))
+}
+
+// loadKeys reads every key file in dir.
+func loadKeys(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Pruned by another instance since the directory was listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	notBefore, err := time.Parse(time.RFC3339, block.Headers["Not-Before"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Not-Before header: %w", err)
+	}
+	key := &Key{ID: block.Headers["Kid"], Algorithm: block.Headers["Algorithm"], NotBefore: notBefore}
+	if key.ID == "" {
+		return nil, errors.New("missing Kid header")
+	}
+
+	switch block.Type {
+	case pemTypeHMACSecret:
+		key.private = block.Bytes
+	case pemTypePrivateKey:
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+
+	var ok bool
+	switch key.Algorithm {
+	case AlgEdDSA:
+		_, ok = key.private.(ed25519.PrivateKey)
+	case AlgRS256:
+		_, ok = key.private.(*rsa.PrivateKey)
+	case AlgHS256:
+		_, ok = key.private.([]byte)
+	}
+	if !ok {
+		return nil, fmt.Errorf("key does not match algorithm %q", key.Algorithm)
+	}
+	return key, nil
+}
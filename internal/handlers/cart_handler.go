@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/models"
+	"mystore/internal/service"
+	"net/http"
+	"strconv"
+)
+
+type CartHandler struct {
+	CartService service.CartService
+}
+
+func NewCartHandler(cartService service.CartService) *CartHandler {
+	return &CartHandler{CartService: cartService}
+}
+
+func (h *CartHandler) GetCart(c *gin.Context) {
+	cart, err := h.CartService.GetCart(cartOwner(c))
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func (h *CartHandler) AddItem(c *gin.Context) {
+	var req models.AddCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cart, err := h.CartService.AddItem(cartOwner(c), &req)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cart, err := h.CartService.UpdateItem(cartOwner(c), productID, req.Quantity)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	cart, err := h.CartService.RemoveItem(cartOwner(c), productID)
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cart})
+}
+
+func (h *CartHandler) Clear(c *gin.Context) {
+	if err := h.CartService.Clear(cartOwner(c)); err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func (h *CartHandler) Checkout(c *gin.Context) {
+	order, err := h.CartService.Checkout(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(cartErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": order})
+}
+
+func cartOwner(c *gin.Context) models.CartOwner {
+	return models.CartOwner{UserID: c.GetInt("user_id"), Token: c.GetString("cart_token")}
+}
+
+func cartErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrProductNotFound), errors.Is(err, models.ErrCartItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrCartEmpty):
+		return http.StatusBadRequest
+	default:
+		return orderErrorStatus(err)
+	}
+}
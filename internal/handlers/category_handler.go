@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/models"
+	"mystore/internal/service"
+	"net/http"
+	"strconv"
+)
+
+type CategoryHandler struct {
+	CategoryService service.CategoryService
+}
+
+func NewCategoryHandler(categoryService service.CategoryService) *CategoryHandler {
+	return &CategoryHandler{CategoryService: categoryService}
+}
+
+func (h *CategoryHandler) GetTree(c *gin.Context) {
+	tree, err := h.CategoryService.GetTree()
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tree})
+}
+
+func (h *CategoryHandler) GetProductsBySlug(c *gin.Context) {
+	products, err := h.CategoryService.GetProductsBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": toProductResponses(products)})
+}
+
+func (h *CategoryHandler) GetAll(c *gin.Context) {
+	categories, err := h.CategoryService.GetAll()
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": categories})
+}
+
+func (h *CategoryHandler) GetById(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	category, err := h.CategoryService.GetById(id)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": category})
+}
+
+func (h *CategoryHandler) Create(c *gin.Context) {
+	var req models.CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category, err := h.CategoryService.Create(&req)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": category})
+}
+
+func (h *CategoryHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category, err := h.CategoryService.Update(id, &req)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": category})
+}
+
+func (h *CategoryHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := h.CategoryService.Delete(id); err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func (h *CategoryHandler) AddProduct(c *gin.Context) {
+	categoryID, productID, ok := categoryProductParams(c)
+	if !ok {
+		return
+	}
+	if err := h.CategoryService.AddProduct(categoryID, productID); err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+func (h *CategoryHandler) RemoveProduct(c *gin.Context) {
+	categoryID, productID, ok := categoryProductParams(c)
+	if !ok {
+		return
+	}
+	if err := h.CategoryService.RemoveProduct(categoryID, productID); err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func categoryProductParams(c *gin.Context) (int, int, bool) {
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return 0, 0, false
+	}
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return 0, 0, false
+	}
+	return categoryID, productID, true
+}
+
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidCategory), errors.Is(err, models.ErrCategoryNeedsSlug):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrCategoryNotFound), errors.Is(err, models.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrCategorySlugTaken), errors.Is(err, models.ErrCategoryCycle),
+		errors.Is(err, models.ErrCategoryHasChildren):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
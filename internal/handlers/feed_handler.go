@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/service"
+	"net/http"
+	"time"
+)
+
+type FeedHandler struct {
+	FeedService service.FeedService
+}
+
+func NewFeedHandler(feedService service.FeedService) *FeedHandler {
+	return &FeedHandler{FeedService: feedService}
+}
+
+// ProductFeed serves the cached RSS product feed. Conditional requests with
+// If-None-Match or If-Modified-Since get a 304 when the feed is unchanged.
+func (h *FeedHandler) ProductFeed(c *gin.Context) {
+	feed, err := h.FeedService.ProductFeed(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build product feed"})
+		return
+	}
+
+	maxAge := int(time.Until(feed.Expires).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	c.Header("Content-Type", "application/rss+xml; charset=utf-8")
+	c.Header("ETag", feed.ETag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	http.ServeContent(c.Writer, c.Request, "products.xml", feed.ModifiedAt, bytes.NewReader(feed.Body))
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"mystore/internal/auth"
+	"net/http"
+)
+
+type KeyHandler struct {
+	Keys *auth.KeyManager
+}
+
+func NewKeyHandler(keys *auth.KeyManager) *KeyHandler {
+	return &KeyHandler{Keys: keys}
+}
+
+// JWKS publishes the public token signing keys. The short max-age lets
+// verifiers pick up a new key well before it starts signing.
+func (h *KeyHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
+}
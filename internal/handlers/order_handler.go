@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/middleware"
+	"mystore/internal/models"
+	"mystore/internal/service"
+	"net/http"
+	"strconv"
+)
+
+type OrderHandler struct {
+	OrderService service.OrderService
+}
+
+func NewOrderHandler(orderService service.OrderService) *OrderHandler {
+	return &OrderHandler{OrderService: orderService}
+}
+
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	var req models.CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.OrderService.CreateOrder(c.GetInt("user_id"), &req)
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": order})
+}
+
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	orders, err := h.OrderService.GetOrdersByUser(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": orders})
+}
+
+func (h *OrderHandler) GetOrderById(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	order, err := h.OrderService.GetOrderById(id, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": order})
+}
+
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	isAdmin := middleware.HasPermission(c, models.PermOrdersWrite)
+	order, err := h.OrderService.CancelOrder(id, c.GetInt("user_id"), isAdmin)
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": order})
+}
+
+func (h *OrderHandler) PayOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	order, payment, err := h.OrderService.PayOrder(id, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error(), "payment": payment})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": order, "payment": payment})
+}
+
+func (h *OrderHandler) GetPayments(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	payments, err := h.OrderService.GetPayments(id)
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": payments})
+}
+
+func (h *OrderHandler) GetAllOrders(c *gin.Context) {
+	orders, err := h.OrderService.GetAllOrders(c.Query("status"))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": orders})
+}
+
+func (h *OrderHandler) GetOrderForAdmin(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	order, err := h.OrderService.GetOrderForAdmin(id)
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": order})
+}
+
+func (h *OrderHandler) UpdateStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Status == models.OrderStatusRefunded && !middleware.HasPermission(c, models.PermOrdersRefund) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + models.PermOrdersRefund})
+		return
+	}
+
+	order, err := h.OrderService.UpdateStatus(id, req.Status, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": order})
+}
+
+func (h *OrderHandler) GetStatusHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	history, err := h.OrderService.GetStatusHistory(id)
+	if err != nil {
+		c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrProductNotFound), errors.Is(err, models.ErrVariantNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrInvalidOrderStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrInsufficientStock), errors.Is(err, models.ErrInvalidTransition),
+		errors.Is(err, models.ErrReservationExpired), errors.Is(err, models.ErrPaymentNotCaptured):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrPaymentDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, models.ErrPaymentTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, models.ErrPaymentFailed):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
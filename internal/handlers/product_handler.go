@@ -1,45 +1,111 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"mystore/internal/models"
 	"mystore/internal/service"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+// imageFormOverhead leaves room for multipart headers and form fields on top
+// of the image itself.
+const imageFormOverhead = 64 << 10
+
+const importMaxBody = 10 << 20
+
 type ProductHandler struct {
 	ProductService service.ProductService
+	ImageService   service.ImageService
+	// Media serves stored images when the blob store serves them itself.
+	Media http.Handler
 }
 
-func NewProductHandler(productService service.ProductService) *ProductHandler {
-	return &ProductHandler{ProductService: productService}
+func NewProductHandler(productService service.ProductService, imageService service.ImageService, media http.Handler) *ProductHandler {
+	return &ProductHandler{ProductService: productService,
+		ImageService: imageService,
+		Media:        media}
 
 }
 
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.ProductService.Create(&product)
+	product := productFromRequest(0, &req)
+	err := h.ProductService.Create(&product, c.GetInt("user_id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"data": product})
+	c.JSON(http.StatusCreated, gin.H{"data": toAdminProductResponse(&product)})
 }
 
-func (h *ProductHandler) GetAllProduct(c *gin.Context) {
-	products, err := h.ProductService.GetAllProduct()
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	var filter models.ProductFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.ProductService.ListProducts(&filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": products})
+	c.JSON(http.StatusOK, gin.H{"data": toProductResponses(page.Items), "next_cursor": page.NextCursor, "total": page.Total, "facets": page.Facets})
+}
+func (h *ProductHandler) Search(c *gin.Context) {
+	var req models.ProductSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.ProductService.Search(&req)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	items := make([]*models.ProductSearchResultResponse, 0, len(page.Items))
+	for _, item := range page.Items {
+		items = append(items, &models.ProductSearchResultResponse{
+			Product: toProductResponse(item.Product),
+			Rank:    item.Rank,
+			Snippet: item.Snippet,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items, "mode": page.Mode})
 }
+
+// Compare takes the products to compare as ?ids=1,2,3.
+func (h *ProductHandler) Compare(c *gin.Context) {
+	var ids []int
+	for _, part := range strings.Split(c.Query("ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		ids = append(ids, id)
+	}
+	comparison, err := h.ProductService.Compare(ids)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": &models.ProductComparisonResponse{
+		Products:       toProductResponses(comparison.Products),
+		Attributes:     comparison.Attributes,
+		LowestPriceIDs: comparison.LowestPriceIDs,
+		LowestPrice:    comparison.LowestPrice,
+	}})
+}
+
 func (h *ProductHandler) GetById(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -51,7 +117,7 @@ func (h *ProductHandler) GetById(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Продукт не найден"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": product})
+	c.JSON(http.StatusOK, gin.H{"data": toProductResponse(product)})
 }
 
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
@@ -60,18 +126,18 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	product.ID = id
-	if err := h.ProductService.Update(&product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	product := productFromRequest(id, &req)
+	if err := h.ProductService.Update(&product, c.GetInt("user_id")); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": product})
+	c.JSON(http.StatusOK, gin.H{"data": toAdminProductResponse(&product)})
 }
 
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
@@ -82,8 +148,370 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	}
 	err = h.ProductService.Delete(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusNoContent, gin.H{"data": true})
 }
+
+func (h *ProductHandler) GetStockHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	history, err := h.ProductService.GetStockHistory(id)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+func (h *ProductHandler) Reconcile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	rec, err := h.ProductService.Reconcile(id)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rec})
+}
+
+func (h *ProductHandler) GetVariants(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	variants, err := h.ProductService.GetVariants(id)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": variants})
+}
+
+func (h *ProductHandler) CreateVariant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	variant, err := h.ProductService.CreateVariant(id, &req, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": variant})
+}
+
+func (h *ProductHandler) UpdateVariant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	variant, err := h.ProductService.UpdateVariant(id, variantID, &req, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": variant})
+}
+
+func (h *ProductHandler) DeleteVariant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := h.ProductService.DeleteVariant(id, variantID); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+// ImportProducts takes the CSV or JSON document as the request body. The
+// format comes from ?format= or else the Content-Type; ?mode= is atomic
+// (default) or per_row. A rolled back atomic import answers 422 with its report.
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		switch c.ContentType() {
+		case "text/csv":
+			format = models.ImportFormatCSV
+		case "application/json":
+			format = models.ImportFormatJSON
+		}
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBody)
+	report, err := h.ProductService.Import(format, c.Query("mode"), body, c.GetInt("user_id"))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import is too large"})
+			return
+		}
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if report.Failed > 0 && !report.Committed && report.Mode == models.ImportModeAtomic {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"data": report})
+}
+
+// exportContentTypes maps each export format to its response content type.
+var exportContentTypes = map[string]string{
+	models.ExportFormatCSV:    "text/csv; charset=utf-8",
+	models.ExportFormatJSON:   "application/json; charset=utf-8",
+	models.ExportFormatNDJSON: "application/x-ndjson",
+}
+
+// ExportProducts streams the catalog as CSV (the default), JSON or NDJSON. It
+// takes the same filters and sort as ListProducts but is not paginated. Once
+// the first product is written the status can no longer change, so a later
+// failure only truncates the download.
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	format := c.DefaultQuery("format", models.ExportFormatCSV)
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of csv, json, ndjson"})
+		return
+	}
+	var filter models.ProductFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format))
+	c.Status(http.StatusOK)
+	err := h.ProductService.Export(c.Request.Context(), format, &filter, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			// gin keeps an existing Content-Type, so drop the export headers
+			// or the JSON error would be served as CSV or NDJSON.
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		_ = c.Error(err)
+	}
+}
+
+// UploadImage accepts a multipart form with the file in "image" and an
+// optional "primary=true" field.
+func (h *ProductHandler) UploadImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxImageSize+imageFormOverhead)
+	file, _, err := c.Request.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": models.ErrImageTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	primary, _ := strconv.ParseBool(c.Request.FormValue("primary"))
+	image, err := h.ImageService.Upload(c.Request.Context(), id, file, primary)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": image})
+}
+
+func (h *ProductHandler) GetImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	images, err := h.ImageService.GetByProduct(id)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": images})
+}
+
+func (h *ProductHandler) ReorderImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var req models.ReorderImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	images, err := h.ImageService.Reorder(id, req.ImageIDs)
+	if err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": images})
+}
+
+func (h *ProductHandler) SetPrimaryImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	imageID, err := strconv.Atoi(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := h.ImageService.SetPrimary(id, imageID); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+func (h *ProductHandler) DeleteImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	imageID, err := strconv.Atoi(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := h.ImageService.Delete(c.Request.Context(), id, imageID); err != nil {
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func (h *ProductHandler) ServeMedia(c *gin.Context) {
+	if h.Media == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	h.Media.ServeHTTP(c.Writer, c.Request)
+}
+
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidCursor), errors.Is(err, models.ErrInvalidFilter), errors.Is(err, models.ErrInvalidImport),
+		errors.Is(err, models.ErrInvalidImageOrder):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrProductNotFound), errors.Is(err, models.ErrVariantNotFound),
+		errors.Is(err, models.ErrImageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, models.ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, models.ErrVariantSKUTaken), errors.Is(err, models.ErrVariantInUse), errors.Is(err, models.ErrProductSKUTaken),
+		errors.Is(err, models.ErrInsufficientStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func productFromRequest(id int, req *models.ProductRequest) models.Product {
+	return models.Product{
+		ID:          id,
+		SKU:         req.SKU,
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Quantity:    req.Quantity,
+	}
+}
+
+func toProductResponse(product *models.Product) *models.ProductResponse {
+	res := &models.ProductResponse{
+		ID:          product.ID,
+		SKU:         product.SKU,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Quantity:    product.Quantity,
+		Available:   product.Available,
+		CreatedAt:   product.CreatedAt,
+		Images:      product.Images,
+	}
+	for _, variant := range product.Variants {
+		res.Variants = append(res.Variants, &models.ProductVariantResponse{
+			ID:        variant.ID,
+			SKU:       variant.SKU,
+			Options:   variant.Options,
+			Price:     variant.Price,
+			Available: variant.Available,
+		})
+	}
+	return res
+}
+
+func toProductResponses(products []*models.Product) []*models.ProductResponse {
+	res := make([]*models.ProductResponse, 0, len(products))
+	for _, product := range products {
+		res = append(res, toProductResponse(product))
+	}
+	return res
+}
+
+func toAdminProductResponse(product *models.Product) *models.AdminProductResponse {
+	return &models.AdminProductResponse{
+		ID:          product.ID,
+		SKU:         product.SKU,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Quantity:    product.Quantity,
+		Available:   product.Available,
+		CreatedAt:   product.CreatedAt,
+		Variants:    product.Variants,
+		Images:      product.Images,
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/models"
+	"mystore/internal/service"
+	"net/http"
+)
+
+type RoleHandler struct {
+	RoleService service.RoleService
+}
+
+func NewRoleHandler(roleService service.RoleService) *RoleHandler {
+	return &RoleHandler{RoleService: roleService}
+}
+
+func (h *RoleHandler) GetAll(c *gin.Context) {
+	roles, err := h.RoleService.GetAll()
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roles})
+}
+
+func (h *RoleHandler) GetByName(c *gin.Context) {
+	role, err := h.RoleService.GetByName(c.Param("name"))
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": role})
+}
+
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	permissions, err := h.RoleService.GetPermissions()
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": permissions})
+}
+
+func (h *RoleHandler) Create(c *gin.Context) {
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.RoleService.Create(&req)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": role})
+}
+
+func (h *RoleHandler) Update(c *gin.Context) {
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.RoleService.Update(c.Param("name"), &req)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": role})
+}
+
+func (h *RoleHandler) Delete(c *gin.Context) {
+	if err := h.RoleService.Delete(c.Param("name")); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidRole), errors.Is(err, models.ErrUnknownPermission):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrRoleNameTaken), errors.Is(err, models.ErrRoleInUse),
+		errors.Is(err, models.ErrRoleProtected):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,35 +1,48 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
+	"mystore/internal/middleware"
 	"mystore/internal/models"
 	"mystore/internal/service"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type UserHandler struct {
-	UserService service.UserService
+	UserService  service.UserService
+	CartService  service.CartService
+	TokenService service.TokenService
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
-	return &UserHandler{UserService: userService}
+func NewUserHandler(userService service.UserService, cartService service.CartService, tokenService service.TokenService) *UserHandler {
+	return &UserHandler{UserService: userService,
+		CartService:  cartService,
+		TokenService: tokenService}
 }
 
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	err := h.UserService.CreateUser(&user)
+	user := models.User{Name: req.Name, Email: req.Email, Password: req.Password, Role: req.Role}
+	err := h.UserService.CreateUser(&user, middleware.HasPermission(c, models.PermRolesManage))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"user": user})
+	if middleware.HasPermission(c, models.PermUsersRead) {
+		c.JSON(http.StatusCreated, gin.H{"user": toAdminUserResponse(&user)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"user": toUserResponse(&user)})
 }
 
 func (h *UserHandler) GetAllUser(c *gin.Context) {
@@ -38,7 +51,7 @@ func (h *UserHandler) GetAllUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, gin.H{"users": toAdminUserResponses(users)})
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
@@ -48,21 +61,56 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	user.ID = int64(id)
+	user := userFromUpdate(int64(id), &req)
 
-	err = h.UserService.UpdateUser(&user)
+	// Roles are assigned by role managers, and never to themselves.
+	canAssignRoles := middleware.HasPermission(c, models.PermRolesManage) && id != c.GetInt("user_id")
+	err = h.UserService.UpdateUser(&user, canAssignRoles, middleware.Permissions(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": toAdminUserResponse(&user)})
+}
+
+// UpdateMe updates the caller's own account. Nobody can change their own role
+// here, whatever their permissions.
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	user := userFromUpdate(int64(c.GetInt("user_id")), &req)
+
+	err := h.UserService.UpdateUser(&user, false, middleware.Permissions(c))
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": toUserResponse(&user)})
+}
+
+// DeleteMe deletes the caller's own account and revokes the access token it
+// was called with; refresh tokens go with the account.
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	if err := h.UserService.DeleteUserById(c.GetInt("user_id"), middleware.Permissions(c)); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	expiresAt, _ := c.Get("token_expires_at")
+	exp, _ := expiresAt.(time.Time)
+	// The account is gone either way; a failed revocation only leaves the
+	// short-lived access token usable until it expires.
+	_ = h.TokenService.Logout("", c.GetString("jti"), exp)
+	c.JSON(http.StatusOK, gin.H{"user": "Successfully deleted user"})
 }
 
 func (h *UserHandler) GetUserByID(c *gin.Context) {
@@ -74,10 +122,10 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 
 	res, err := h.UserService.GetUserById(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": res})
+	c.JSON(http.StatusOK, gin.H{"user": toAdminUserResponse(res)})
 
 }
 
@@ -89,7 +137,7 @@ func (h *UserHandler) GetUserByUsername(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": res})
+	c.JSON(http.StatusOK, gin.H{"user": toAdminUserResponse(res)})
 }
 
 func (h *UserHandler) GetUserByEmail(c *gin.Context) {
@@ -99,7 +147,7 @@ func (h *UserHandler) GetUserByEmail(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": res})
+	c.JSON(http.StatusOK, gin.H{"user": toAdminUserResponse(res)})
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
@@ -109,9 +157,9 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err = h.UserService.DeleteUserById(id)
+	err = h.UserService.DeleteUserById(id, middleware.Permissions(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found with id", "details": err.Error()})
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"user": "Successfully deleted user"})
@@ -123,12 +171,73 @@ func (h *UserHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	token, err := h.UserService.Login(req.Email, req.Password)
+	pair, user, err := h.UserService.Login(req.Email, req.Password)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+
+	if cartToken, err := c.Cookie(middleware.CartTokenCookie); err == nil && cartToken != "" {
+		// A failed merge leaves the guest cart in place and must not block the login.
+		_ = h.CartService.MergeGuestCart(cartToken, int(user.ID))
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pair, err := h.TokenService.Refresh(req.RefreshToken)
+	if err != nil {
+		c.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout revokes the refresh token in the body, if any, with its whole
+// family, and the access token the request was authenticated with.
+func (h *UserHandler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expiresAt, _ := c.Get("token_expires_at")
+	exp, _ := expiresAt.(time.Time)
+	if err := h.TokenService.Logout(req.RefreshToken, c.GetString("jti"), exp); err != nil {
+		c.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"data": true})
+}
+
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrRoleNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrRoleEscalation), errors.Is(err, models.ErrUserProtected):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrEmailTaken):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func tokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidRefreshToken), errors.Is(err, models.ErrRefreshTokenReused):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func (h *UserHandler) GetMe(c *gin.Context) {
@@ -139,5 +248,35 @@ func (h *UserHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": toUserResponse(user)})
+}
+
+func userFromUpdate(id int64, req *models.UpdateUserRequest) models.User {
+	return models.User{ID: id, Name: req.Name, Email: req.Email, Password: req.Password, Role: req.Role}
+}
+
+func toUserResponse(user *models.User) *models.UserResponse {
+	return &models.UserResponse{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+	}
+}
+
+func toAdminUserResponse(user *models.User) *models.AdminUserResponse {
+	return &models.AdminUserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func toAdminUserResponses(users []*models.User) []*models.AdminUserResponse {
+	res := make([]*models.AdminUserResponse, 0, len(users))
+	for _, user := range users {
+		res = append(res, toAdminUserResponse(user))
+	}
+	return res
 }
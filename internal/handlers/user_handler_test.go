@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"mystore/internal/models"
+	"mystore/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPasswordHash = "$2a$10$7EqJtq98hPqEX7fNZaFWoO5rFzYqTkEx4Pw3CeGnCDqAEy5n2a9Vu"
+
+// fakeUserService stores users in memory and, like the real service, keeps
+// bcrypt hashes in User.Password.
+type fakeUserService struct {
+	service.UserService
+	users map[int64]*models.User
+}
+
+func newFakeUserService() *fakeUserService {
+	return &fakeUserService{users: map[int64]*models.User{
+		1: {ID: 1, Name: "Ann", Email: "ann@example.com", Password: testPasswordHash, Role: models.RoleAdmin, CreatedAt: time.Now()},
+	}}
+}
+
+func (s *fakeUserService) CreateUser(user *models.User, _ bool) error {
+	user.ID = int64(len(s.users) + 1)
+	user.Password = testPasswordHash
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	user.CreatedAt = time.Now()
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *fakeUserService) GetAllUsers() ([]*models.User, error) {
+	users := make([]*models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (s *fakeUserService) GetUserById(id int) (*models.User, error) {
+	user, ok := s.users[int64(id)]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *fakeUserService) UpdateUser(user *models.User, _ bool, _ []string) error {
+	current, ok := s.users[user.ID]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	if user.Name == "" {
+		user.Name = current.Name
+	}
+	if user.Email == "" {
+		user.Email = current.Email
+	}
+	if user.Role == "" {
+		user.Role = current.Role
+	}
+	user.Password = testPasswordHash
+	user.CreatedAt = current.CreatedAt
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// findKey reports whether key appears at any depth of a decoded JSON value.
+func findKey(v any, key string) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if strings.EqualFold(k, key) || findKey(child, key) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if findKey(child, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestUserResponsesNeverContainPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewUserHandler(newFakeUserService(), nil, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("permissions", []string{models.PermUsersRead, models.PermUsersWrite, models.PermRolesManage})
+		c.Next()
+	})
+	router.POST("/user/", h.CreateUser)
+	router.GET("/user/", h.GetAllUser)
+	router.GET("/user/:id", h.GetUserByID)
+	router.GET("/me", h.GetMe)
+	router.PUT("/me", h.UpdateMe)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"CreateUser", http.MethodPost, "/user/", `{"name":"Bob","email":"bob@example.com","password":"secret123"}`, http.StatusCreated},
+		{"GetAllUser", http.MethodGet, "/user/", "", http.StatusOK},
+		{"GetUserByID", http.MethodGet, "/user/1", "", http.StatusOK},
+		{"GetMe", http.MethodGet, "/me", "", http.StatusOK},
+		{"UpdateMe", http.MethodPut, "/me", `{"name":"Annie","password":"another-secret"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var body any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if findKey(body, "password") {
+				t.Errorf("response contains a password key: %s", rec.Body)
+			}
+			if strings.Contains(rec.Body.String(), testPasswordHash) {
+				t.Errorf("response contains the password hash: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mystore/internal/models"
+	"mystore/internal/payment"
+	"mystore/internal/service"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookMaxBody   = 1 << 20
+	webhookTolerance = 5 * time.Minute
+)
+
+type WebhookHandler struct {
+	WebhookService service.PaymentWebhookService
+	Secret         []byte
+}
+
+func NewWebhookHandler(webhookService service.PaymentWebhookService, secret []byte) *WebhookHandler {
+	return &WebhookHandler{WebhookService: webhookService,
+		Secret: secret}
+}
+
+func (h *WebhookHandler) PaymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, webhookMaxBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "webhook body is too large"})
+		return
+	}
+
+	err = payment.VerifyWebhookSignature(h.Secret, c.GetHeader(payment.TimestampHeader),
+		c.GetHeader(payment.SignatureHeader), body, webhookTolerance, time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var event payment.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.OrderID <= 0 || event.Reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := h.WebhookService.HandleEvent(&event); err != nil {
+		switch {
+		case errors.Is(err, models.ErrWebhookReplay):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrPaymentMismatch):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(orderErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "processed"})
+}
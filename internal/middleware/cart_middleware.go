@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	CartTokenCookie = "cart_token"
+	cartTokenMaxAge = 30 * 24 * 60 * 60
+	cartTokenBytes  = 32
+)
+
+// CartToken makes sure every request carries an opaque guest cart token. An
+// existing well-formed cookie is reused; otherwise a new random token is issued.
+// The token is stored in the context under "cart_token".
+func CartToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(CartTokenCookie)
+		if err != nil || !validCartToken(token) {
+			token, err = newCartToken()
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to issue cart token"})
+				return
+			}
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(CartTokenCookie, token, cartTokenMaxAge, "/", "", c.Request.TLS != nil, true)
+		}
+		c.Set("cart_token", token)
+		c.Next()
+	}
+}
+
+func newCartToken() (string, error) {
+	buf := make([]byte, cartTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func validCartToken(token string) bool {
+	if len(token) != cartTokenBytes*2 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"net/http"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// responseRecorder copies everything the handler writes so the response can be
+// stored for replay.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency honours the Idempotency-Key header. The first response for a key
+// is stored per user and route and replayed for repeated requests; reusing the
+// key with a different body is rejected with 422. Server errors are not stored
+// so the client can retry them. Requests without the header pass through.
+// It must run after AuthMiddleware on authenticated routes.
+func Idempotency(store repository.IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		record, claimed, err := store.Begin(&models.IdempotencyRecord{
+			UserID:      c.GetInt("user_id"),
+			Route:       c.Request.Method + " " + c.FullPath(),
+			Key:         key,
+			RequestHash: hex.EncodeToString(hash[:]),
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process Idempotency-Key"})
+			return
+		}
+
+		if !claimed {
+			switch {
+			case record.RequestHash != hex.EncodeToString(hash[:]):
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			case record.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header(IdempotencyReplayedHeader, "true")
+				c.Data(record.StatusCode, record.ContentType, record.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer func() {
+			status := recorder.Status()
+			if recovered := recover(); recovered != nil || status >= http.StatusInternalServerError {
+				_ = store.Release(record)
+				if recovered != nil {
+					panic(recovered)
+				}
+				return
+			}
+			record.StatusCode = status
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.ResponseBody = recorder.body.Bytes()
+			_ = store.Complete(record)
+		}()
+		c.Next()
+	}
+}
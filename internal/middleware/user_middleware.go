@@ -1,72 +1,140 @@
 package middleware
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"mystore/internal/auth"
 	"net/http"
 	"strings"
 	"time"
 )
 
-func AuthMiddleware(jwtKey []byte) gin.HandlerFunc {
+// RevocationList reports whether an access token, identified by its jti
+// claim, was revoked before it expired.
+type RevocationList interface {
+	IsRevoked(jti string) (bool, error)
+}
+
+func AuthMiddleware(keys *auth.KeyManager, revocations RevocationList) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is empty"})
 			return
 		}
-
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is invalid"})
+		if !authenticate(c, authHeader, keys, revocations) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtKey, nil
-		})
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+// OptionalAuthMiddleware authenticates the request when an Authorization
+// header is present and lets anonymous requests through untouched, so
+// handlers can serve both guests and signed-in users.
+func OptionalAuthMiddleware(keys *auth.KeyManager, revocations RevocationList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" && !authenticate(c, authHeader, keys, revocations) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid or expired token"})
-			return
-		}
+// authenticate validates the bearer token, rejects revoked tokens and stores
+// the claims in the context. On failure it aborts the request and returns
+// false.
+func authenticate(c *gin.Context, authHeader string, keys *auth.KeyManager, revocations RevocationList) bool {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is invalid"})
+		return false
+	}
 
-		exp := int64(claims["exp"].(float64))
-		if time.Unix(exp, 0).Before(time.Now()) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			return
-		}
+	tokenString := parts[1]
+	token, err := jwt.Parse(tokenString, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid or expired token"})
+		return false
+	}
 
-		c.Set("user_id", int(claims["user_id"].(float64)))
-		c.Set("role", claims["role"].(string))
+	exp := int64(claims["exp"].(float64))
+	if time.Unix(exp, 0).Before(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return false
+	}
 
-		c.Next()
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return false
+	}
+	revoked, err := revocations.IsRevoked(jti)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not verify token"})
+		return false
+	}
+	if revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+		return false
 	}
+
+	c.Set("user_id", int(claims["user_id"].(float64)))
+	c.Set("role", claims["role"].(string))
+	c.Set("permissions", permissionClaims(claims))
+	c.Set("jti", jti)
+	c.Set("token_expires_at", time.Unix(exp, 0))
+	return true
 }
 
-func AdminOnly() gin.HandlerFunc {
+// RequirePermission lets the request through only when the access token
+// grants every listed permission. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roleVal, exists := c.Get("role")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "role is missing"})
-			return
-		}
-		role, ok := roleVal.(string)
-		if !ok || role != "admin" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "role is invalid"})
-			return
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + permission})
+				return
+			}
 		}
 		c.Next()
 	}
+}
+
+// HasPermission reports whether the authenticated request's token grants the
+// permission, for handlers whose checks depend on the request body.
+func HasPermission(c *gin.Context, permission string) bool {
+	for _, p := range Permissions(c) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
 
+// Permissions returns the permissions granted to the authenticated caller.
+func Permissions(c *gin.Context) []string {
+	granted, _ := c.Get("permissions")
+	permissions, _ := granted.([]string)
+	return permissions
+}
+
+// permissionClaims reads the "permissions" claim. Tokens without it grant no
+// permissions.
+func permissionClaims(claims jwt.MapClaims) []string {
+	list, _ := claims["permissions"].([]interface{})
+	permissions := make([]string, 0, len(list))
+	for _, item := range list {
+		if permission, ok := item.(string); ok {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
 }
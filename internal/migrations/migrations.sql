@@ -32,4 +32,286 @@ CREATE TABLE order_items (
     price NUMERIC(10, 2) NOT NULL CHECK (price >= 0),
     FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
     FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT
-);
\ No newline at end of file
+);
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE TABLE order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    from_status VARCHAR(30),
+    to_status VARCHAR(30) NOT NULL,
+    changed_by INT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history (order_id);
+
+CREATE TABLE carts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE cart_items (
+    id SERIAL PRIMARY KEY,
+    cart_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (cart_id, product_id),
+    FOREIGN KEY (cart_id) REFERENCES carts(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+ALTER TABLE carts ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE carts ADD COLUMN token VARCHAR(64) UNIQUE;
+ALTER TABLE carts ADD CONSTRAINT carts_owner_check CHECK (user_id IS NOT NULL OR token IS NOT NULL);
+
+CREATE TABLE stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'committed', 'released')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_stock_reservations_order_id ON stock_reservations (order_id);
+CREATE INDEX idx_stock_reservations_active ON stock_reservations (product_id, expires_at) WHERE status = 'active';
+
+-- order_id and actor_id are kept as plain references so ledger rows survive
+-- deletion of the orders and users they mention.
+CREATE TABLE inventory_movements (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL,
+    delta INT NOT NULL CHECK (delta <> 0),
+    reason VARCHAR(30) NOT NULL CHECK (reason IN ('sale', 'restock', 'adjustment', 'cancellation', 'return')),
+    order_id INT,
+    actor_id INT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_inventory_movements_product_id ON inventory_movements (product_id, created_at);
+
+CREATE FUNCTION inventory_movements_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'inventory_movements rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER inventory_movements_no_update
+    BEFORE UPDATE ON inventory_movements
+    FOR EACH ROW EXECUTE FUNCTION inventory_movements_immutable();
+
+INSERT INTO inventory_movements (product_id, delta, reason)
+SELECT id, quantity, 'adjustment' FROM products WHERE quantity <> 0;
+
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    provider_ref VARCHAR(100),
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount >= 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'initiated'
+        CHECK (status IN ('initiated', 'authorized', 'captured', 'declined', 'failed', 'refunded')),
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_payments_order_id ON payments (order_id);
+CREATE UNIQUE INDEX idx_payments_provider_ref ON payments (provider, provider_ref);
+
+CREATE TABLE webhook_events (
+    event_id VARCHAR(100) PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    received_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE idempotency_keys (
+    user_id INT NOT NULL DEFAULT 0,
+    route VARCHAR(200) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT,
+    content_type VARCHAR(100),
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, route, idempotency_key)
+);
+
+CREATE TABLE categories (
+    id SERIAL PRIMARY KEY,
+    parent_id INT REFERENCES categories(id) ON DELETE RESTRICT,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT categories_not_own_parent CHECK (parent_id IS NULL OR parent_id <> id)
+);
+
+CREATE INDEX idx_categories_parent_id ON categories(parent_id);
+
+CREATE TABLE product_categories (
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX idx_product_categories_category_id ON product_categories(category_id);
+
+-- A variant with a NULL price sells at its product's price. Variant stock is
+-- tracked separately from products.quantity.
+CREATE TABLE product_variants (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    options JSONB NOT NULL DEFAULT '{}',
+    price NUMERIC(10, 2) CHECK (price IS NULL OR price >= 0),
+    quantity INT NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_product_variants_product_id ON product_variants (product_id);
+
+ALTER TABLE order_items ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE RESTRICT;
+ALTER TABLE stock_reservations ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE;
+-- Like order_id, variant_id is a plain reference so ledger rows outlive the variant.
+ALTER TABLE inventory_movements ADD COLUMN variant_id INT;
+
+CREATE INDEX idx_stock_reservations_variant_active ON stock_reservations (variant_id, expires_at)
+    WHERE status = 'active' AND variant_id IS NOT NULL;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The 'simple' configuration keeps search language-neutral; names weigh more
+-- than descriptions in ranking.
+ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+) STORED;
+
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
+
+CREATE TABLE product_images (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL CHECK (size_bytes > 0),
+    position INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_product_images_product_id ON product_images (product_id, position);
+CREATE UNIQUE INDEX idx_product_images_primary ON product_images (product_id) WHERE is_primary;
+
+ALTER TABLE products ADD COLUMN sku VARCHAR(64) UNIQUE;
+
+-- Refresh tokens are stored as SHA-256 hashes. Every rotation adds a row to
+-- the same family; presenting a rotated (used) token again revokes the family.
+-- access_jti is the access token issued together with the refresh token, so
+-- revoking a family can also revoke its outstanding access tokens.
+CREATE TABLE refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    family_id CHAR(32) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    access_jti CHAR(32) NOT NULL,
+    access_expires_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Access tokens revoked before they expire, keyed by their jti claim. Rows
+-- are only needed until expires_at.
+CREATE TABLE revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Roles grant permissions; users.role names a role. The permission names are
+-- referenced by the routes, so new ones arrive with a migration, while roles
+-- and their grants are managed at runtime under /admin/roles.
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('products:read', 'View stock history, images, variants and exports of products'),
+    ('products:write', 'Create, update, import and delete products, variants and images'),
+    ('categories:write', 'Manage categories and their products'),
+    ('orders:read', 'View all orders, their history and payments'),
+    ('orders:write', 'Change order status and cancel any order'),
+    ('orders:refund', 'Refund orders'),
+    ('users:read', 'View user accounts'),
+    ('users:write', 'Update and delete user accounts and assign roles'),
+    ('roles:manage', 'Create, update and delete roles');
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access'),
+    ('user', 'Customer account');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+-- Keep any role already assigned to a user before it can be enforced.
+INSERT INTO roles (name)
+SELECT DISTINCT role FROM users WHERE role IS NOT NULL
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ALTER COLUMN role TYPE VARCHAR(50);
+ALTER TABLE users ADD FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+
+-- The inventory ledger is append-only: rows cannot be deleted or truncated
+-- either, and products with stock history can no longer be deleted.
+CREATE TRIGGER inventory_movements_no_delete
+    BEFORE DELETE ON inventory_movements
+    FOR EACH ROW EXECUTE FUNCTION inventory_movements_immutable();
+
+CREATE TRIGGER inventory_movements_no_truncate
+    BEFORE TRUNCATE ON inventory_movements
+    FOR EACH STATEMENT EXECUTE FUNCTION inventory_movements_immutable();
+
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_product_id_fkey;
+ALTER TABLE inventory_movements ADD FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT;
+
+-- Deleting a product archives it, since its orders and stock history must
+-- keep pointing at it. Archived products are hidden from the storefront.
+ALTER TABLE products ADD COLUMN archived_at TIMESTAMP;
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// CartOwner identifies whose cart a request works on: a signed-in user or an
+// anonymous shopper holding a cart token cookie. UserID wins when both are set.
+type CartOwner struct {
+	UserID int
+	Token  string
+}
+
+type Cart struct {
+	ID        int        `json:"id"`
+	UserID    *int       `json:"user_id"`
+	Items     []CartItem `json:"items"`
+	Total     float64    `json:"total"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// CartItem is a cart line joined with the current product data; Price and
+// LineTotal always reflect products.price at the time the cart is read.
+type CartItem struct {
+	ID        int     `json:"id"`
+	CartID    int     `json:"cart_id"`
+	ProductID int     `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Quantity  int     `json:"quantity"`
+	Available int     `json:"available"`
+	LineTotal float64 `json:"line_total"`
+}
+
+type AddCartItemRequest struct {
+	ProductID int `json:"product_id" binding:"required,gt=0"`
+	Quantity  int `json:"quantity" binding:"required,gt=0"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,gt=0"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Category struct {
+	ID        int         `json:"id"`
+	ParentID  *int        `json:"parent_id"`
+	Name      string      `json:"name"`
+	Slug      string      `json:"slug"`
+	CreatedAt time.Time   `json:"created_at"`
+	Children  []*Category `json:"children,omitempty"`
+}
+
+// CategoryRequest creates or updates a category. An empty slug is derived
+// from the name; a nil parent makes it a top-level category.
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Slug     string `json:"slug"`
+	ParentID *int   `json:"parent_id"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "errors"
+
+// Domain errors shared between repositories, services and handlers so that
+// handlers can map them to HTTP status codes with errors.Is.
+var (
+	ErrProductNotFound     = errors.New("product not found")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidOrderStatus  = errors.New("invalid order status")
+	ErrInvalidTransition   = errors.New("order status transition is not allowed")
+	ErrCartItemNotFound    = errors.New("cart item not found")
+	ErrCartEmpty           = errors.New("cart is empty")
+	ErrReservationExpired  = errors.New("stock reservation has expired")
+	ErrPaymentDeclined     = errors.New("payment declined")
+	ErrPaymentTimeout      = errors.New("payment provider timed out")
+	ErrPaymentFailed       = errors.New("payment failed")
+	ErrPaymentMismatch     = errors.New("payment does not match the order")
+	ErrPaymentNotCaptured  = errors.New("order has no captured payment")
+	ErrWebhookReplay       = errors.New("webhook event was already processed")
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrCategorySlugTaken   = errors.New("category slug is already taken")
+	ErrCategoryCycle       = errors.New("category cannot be nested under itself or its descendants")
+	ErrCategoryHasChildren = errors.New("category still has subcategories")
+	ErrInvalidCategory     = errors.New("invalid category fields")
+	ErrCategoryNeedsSlug   = errors.New("slug is required when the category name has no latin letters or digits")
+	ErrVariantNotFound     = errors.New("product variant not found")
+	ErrVariantSKUTaken     = errors.New("variant SKU is already taken")
+	ErrVariantInUse        = errors.New("product variant is referenced by orders")
+	ErrInvalidCursor       = errors.New("invalid pagination cursor")
+	ErrInvalidFilter       = errors.New("invalid filter")
+	ErrImageNotFound       = errors.New("product image not found")
+	ErrImageTooLarge       = errors.New("image is too large")
+	ErrUnsupportedImage    = errors.New("unsupported image type")
+	ErrInvalidImageOrder   = errors.New("invalid image order")
+	ErrProductSKUTaken     = errors.New("product SKU is already taken")
+	ErrInvalidImport       = errors.New("invalid product import")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrRoleNameTaken       = errors.New("role name is already taken")
+	ErrRoleInUse           = errors.New("role is still assigned to users")
+	ErrRoleProtected       = errors.New("built-in role cannot be changed")
+	ErrUnknownPermission   = errors.New("unknown permission")
+	ErrInvalidRole         = errors.New("invalid role")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrRoleEscalation      = errors.New("not allowed to assign roles")
+	ErrUserProtected       = errors.New("not allowed to manage this user")
+	ErrEmailTaken          = errors.New("user with this email already exists")
+)
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. StatusCode is 0 while the first request is still
+// being processed.
+type IdempotencyRecord struct {
+	UserID       int
+	Route        string
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
@@ -2,9 +2,37 @@ package models
 
 import "time"
 
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
 type Orders struct {
-	ID        int       `json:"id"`
-	UserId    int       `json:"user_id"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int         `json:"id"`
+	UserId    int         `json:"user_id"`
+	Status    string      `json:"status"`
+	Total     float64     `json:"total"`
+	Items     []OrderItem `json:"items"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type OrderStatusHistory struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"order_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  *int      `json:"changed_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateOrderRequest struct {
+	Items []OrderItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" binding:"required"`
 }
@@ -4,6 +4,13 @@ type OrderItem struct {
 	ID        int     `json:"id"`
 	OrderID   int     `json:"order_id"`
 	ProductID int     `json:"product_id"`
+	VariantID *int    `json:"variant_id"`
 	Quantity  int     `json:"quantity"`
 	Price     float64 `json:"price"`
 }
+
+type OrderItemRequest struct {
+	ProductID int `json:"product_id" binding:"required,gt=0"`
+	VariantID int `json:"variant_id" binding:"omitempty,gt=0"`
+	Quantity  int `json:"quantity" binding:"required,gt=0"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	PaymentStatusInitiated  = "initiated"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusDeclined   = "declined"
+	PaymentStatusFailed     = "failed"
+	PaymentStatusRefunded   = "refunded"
+)
+
+// Payment is one attempt to pay an order through a payment provider.
+type Payment struct {
+	ID          int       `json:"id"`
+	OrderID     int       `json:"order_id"`
+	Provider    string    `json:"provider"`
+	ProviderRef string    `json:"provider_ref"`
+	Amount      float64   `json:"amount"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
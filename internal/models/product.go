@@ -4,9 +4,62 @@ import "time"
 
 type Product struct {
 	ID          int       `json:"ID"`
+	SKU         string    `json:"sku"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Price       float64   `json:"price"`
 	Quantity    int       `json:"quantity"`
+	Available   int       `json:"available"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	Variants []*ProductVariant `json:"variants,omitempty"`
+	Images   []*ProductImage   `json:"images,omitempty"`
+}
+
+// ProductRequest creates or updates a product. Availability, variants and
+// images are managed by the store and their own endpoints.
+type ProductRequest struct {
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Quantity    int     `json:"quantity"`
+}
+
+// ProductResponse is the public view of a product, with both the stock on
+// hand and the part of it not held by reservations.
+type ProductResponse struct {
+	ID          int                       `json:"ID"`
+	SKU         string                    `json:"sku"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Price       float64                   `json:"price"`
+	Quantity    int                       `json:"quantity"`
+	Available   int                       `json:"available"`
+	CreatedAt   time.Time                 `json:"created_at"`
+	Variants    []*ProductVariantResponse `json:"variants,omitempty"`
+	Images      []*ProductImage           `json:"images,omitempty"`
+}
+
+// ProductVariantResponse is the public view of a variant.
+type ProductVariantResponse struct {
+	ID        int               `json:"id"`
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     *float64          `json:"price"`
+	Available int               `json:"available"`
+}
+
+// AdminProductResponse is the product as shown to staff, with its stock.
+type AdminProductResponse struct {
+	ID          int               `json:"ID"`
+	SKU         string            `json:"sku"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Price       float64           `json:"price"`
+	Quantity    int               `json:"quantity"`
+	Available   int               `json:"available"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Variants    []*ProductVariant `json:"variants,omitempty"`
+	Images      []*ProductImage   `json:"images,omitempty"`
 }
@@ -0,0 +1,29 @@
+package models
+
+// MaxCompareProducts caps how many products one comparison may include.
+const MaxCompareProducts = 5
+
+// ProductComparison lines up the compared products attribute by attribute.
+// Values in every row follow the order of Products.
+type ProductComparison struct {
+	Products       []*Product      `json:"products"`
+	Attributes     []ComparisonRow `json:"attributes"`
+	LowestPriceIDs []int           `json:"lowest_price_product_ids"`
+	LowestPrice    float64         `json:"lowest_price"`
+}
+
+// ComparisonRow holds one attribute of every compared product. Differs is set
+// when not all products share the same value.
+type ComparisonRow struct {
+	Attribute string `json:"attribute"`
+	Values    []any  `json:"values"`
+	Differs   bool   `json:"differs"`
+}
+
+// ProductComparisonResponse is a comparison as shown to clients.
+type ProductComparisonResponse struct {
+	Products       []*ProductResponse `json:"products"`
+	Attributes     []ComparisonRow    `json:"attributes"`
+	LowestPriceIDs []int              `json:"lowest_price_product_ids"`
+	LowestPrice    float64            `json:"lowest_price"`
+}
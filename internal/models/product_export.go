@@ -0,0 +1,7 @@
+package models
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+)
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ProductFeed is a rendered product feed and the validators clients use to
+// revalidate it. ModifiedAt only moves when the body changes; Expires is when
+// the cached copy will be rebuilt.
+type ProductFeed struct {
+	Body       []byte
+	ETag       string
+	ModifiedAt time.Time
+	Expires    time.Time
+}
@@ -0,0 +1,42 @@
+package models
+
+const (
+	ProductSortPrice     = "price"
+	ProductSortName      = "name"
+	ProductSortCreatedAt = "created_at"
+
+	DefaultProductLimit = 20
+	MaxProductLimit     = 100
+)
+
+// ProductFilter narrows and orders a product listing. Sort is one of the
+// ProductSort fields, prefixed with "-" for descending order. Cursor is the
+// opaque next_cursor of the previous page and must be used with the same sort.
+type ProductFilter struct {
+	Limit    int      `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor   string   `form:"cursor"`
+	Sort     string   `form:"sort" binding:"omitempty,oneof=price -price name -name created_at -created_at"`
+	MinPrice *float64 `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice *float64 `form:"max_price" binding:"omitempty,min=0"`
+	InStock  bool     `form:"in_stock"`
+	Query    string   `form:"q"`
+}
+
+type ProductPage struct {
+	Items      []*Product `json:"items"`
+	NextCursor string     `json:"next_cursor"`
+	Total      int        `json:"total"`
+	Facets     []*Facet   `json:"facets"`
+}
+
+// Facet counts the products matching the current filter in each bucket of
+// one attribute, e.g. price ranges.
+type Facet struct {
+	Name    string        `json:"name"`
+	Buckets []FacetBucket `json:"buckets"`
+}
+
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type ProductImage struct {
+	ID          int       `json:"id"`
+	ProductID   int       `json:"product_id"`
+	URL         string    `json:"url"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Position    int       `json:"position"`
+	IsPrimary   bool      `json:"is_primary"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ReorderImagesRequest struct {
+	ImageIDs []int `json:"image_ids" binding:"required,min=1"`
+}
@@ -0,0 +1,36 @@
+package models
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatJSON = "json"
+
+	ImportModeAtomic = "atomic"
+	ImportModePerRow = "per_row"
+
+	ImportStatusCreated = "created"
+	ImportStatusUpdated = "updated"
+	ImportStatusFailed  = "failed"
+	ImportStatusSkipped = "skipped"
+)
+
+// ImportRowResult reports what happened to one imported record. Row counts
+// data records from 1, not counting a CSV header.
+type ImportRowResult struct {
+	Row       int    `json:"row"`
+	SKU       string `json:"sku"`
+	Status    string `json:"status"`
+	ProductID int    `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport summarises an import. Committed tells whether any product was
+// written; in atomic mode a failed row leaves every other row skipped.
+type ImportReport struct {
+	Mode      string            `json:"mode"`
+	Committed bool              `json:"committed"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Rows      []ImportRowResult `json:"rows"`
+}
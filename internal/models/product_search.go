@@ -0,0 +1,35 @@
+package models
+
+const (
+	SearchModeFullText = "fulltext"
+	SearchModeFuzzy    = "fuzzy"
+)
+
+type ProductSearchRequest struct {
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ProductSearchResult is a product matched by search. Snippet is an
+// HTML-escaped excerpt of the product text with the matched terms wrapped in
+// <mark> tags; fuzzy matches mark the whole product name.
+type ProductSearchResult struct {
+	Product *Product `json:"product"`
+	Rank    float64  `json:"rank"`
+	Snippet string   `json:"snippet"`
+}
+
+// ProductSearchPage holds the results and the mode that produced them:
+// fulltext, or fuzzy when full-text search found nothing and the results come
+// from trigram similarity on product names.
+type ProductSearchPage struct {
+	Items []*ProductSearchResult `json:"items"`
+	Mode  string                 `json:"mode"`
+}
+
+// ProductSearchResultResponse is a search result as shown to clients.
+type ProductSearchResultResponse struct {
+	Product *ProductResponse `json:"product"`
+	Rank    float64          `json:"rank"`
+	Snippet string           `json:"snippet"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ProductVariant is a sellable version of a product, such as size=M/color=red.
+// Price overrides the product price when set; Quantity is the variant's own stock.
+type ProductVariant struct {
+	ID        int               `json:"id"`
+	ProductID int               `json:"product_id"`
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     *float64          `json:"price"`
+	Quantity  int               `json:"quantity"`
+	Available int               `json:"available"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type ProductVariantRequest struct {
+	SKU      string            `json:"sku" binding:"required"`
+	Options  map[string]string `json:"options"`
+	Price    *float64          `json:"price"`
+	Quantity int               `json:"quantity" binding:"gte=0"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Permission names checked by the routes. Roles grant any set of them.
+const (
+	PermProductsRead    = "products:read"
+	PermProductsWrite   = "products:write"
+	PermCategoriesWrite = "categories:write"
+	PermOrdersRead      = "orders:read"
+	PermOrdersWrite     = "orders:write"
+	PermOrdersRefund    = "orders:refund"
+	PermUsersRead       = "users:read"
+	PermUsersWrite      = "users:write"
+	PermRolesManage     = "roles:manage"
+)
+
+// Built-in roles. RoleAdmin holds every permission and RoleUser is given to
+// new accounts; neither can be changed or deleted through the API.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// RoleRequest creates a role, or on update replaces its description and
+// permissions; the name of an existing role cannot change.
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	StockReasonSale         = "sale"
+	StockReasonRestock      = "restock"
+	StockReasonAdjustment   = "adjustment"
+	StockReasonCancellation = "cancellation"
+	StockReasonReturn       = "return"
+)
+
+// StockMovement is an immutable inventory ledger entry. Movements without a
+// variant sum up to the product quantity; those with a variant sum up to that
+// variant's quantity.
+type StockMovement struct {
+	ID        int       `json:"id"`
+	ProductID int       `json:"product_id"`
+	VariantID *int      `json:"variant_id"`
+	Delta     int       `json:"delta"`
+	Reason    string    `json:"reason"`
+	OrderID   *int      `json:"order_id"`
+	ActorID   *int      `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StockReconciliation struct {
+	ProductID      int  `json:"product_id"`
+	Quantity       int  `json:"quantity"`
+	LedgerQuantity int  `json:"ledger_quantity"`
+	Drift          int  `json:"drift"`
+	InSync         bool `json:"in_sync"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// RefreshToken is one link in a refresh token family. Only the hash of the
+// token is stored; UsedAt is set once it has been exchanged for a new pair.
+// Expired is computed by the database when the token is read.
+type RefreshToken struct {
+	ID              int
+	UserID          int
+	FamilyID        string
+	TokenHash       string
+	AccessJTI       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	Expired         bool
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+	CreatedAt       time.Time
+}
+
+// TokenPair is returned on login and refresh. Token is the short-lived access
+// token; ExpiresIn is its lifetime in seconds.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -2,11 +2,13 @@ package models
 
 import "time"
 
+// User is the stored account. Password holds the bcrypt hash and is never
+// serialised; handlers answer with UserResponse.
 type User struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
+	Password  string    `json:"-"`
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -15,3 +17,36 @@ type LoginRequest struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+// CreateUserRequest registers an account. Role is only honoured for callers
+// allowed to manage users.
+type CreateUserRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,max=72"`
+	Role     string `json:"role"`
+}
+
+// UpdateUserRequest changes the fields that are set and keeps the others.
+type UpdateUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password" binding:"max=72"`
+	Role     string `json:"role"`
+}
+
+// UserResponse is the public view of an account, as its owner sees it.
+type UserResponse struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// AdminUserResponse is the account as shown to staff managing users.
+type AdminUserResponse struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
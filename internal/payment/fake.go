@@ -0,0 +1,140 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type FakeMode string
+
+const (
+	FakeSucceed FakeMode = "succeed"
+	FakeDecline FakeMode = "decline"
+	FakeTimeout FakeMode = "timeout"
+)
+
+// ParseFakeMode turns a config value into a FakeMode; empty means succeed.
+func ParseFakeMode(s string) (FakeMode, error) {
+	switch mode := FakeMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return FakeSucceed, nil
+	case FakeSucceed, FakeDecline, FakeTimeout:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown fake payment mode %q", s)
+	}
+}
+
+// FakeProvider is an in-process PaymentProvider for local development and
+// tests. Depending on its mode every authorization succeeds, is declined, or
+// hangs until the caller's context expires.
+type FakeProvider struct {
+	mu       sync.Mutex
+	mode     FakeMode
+	seq      int
+	payments map[string]*Result
+}
+
+func NewFakeProvider(mode FakeMode) *FakeProvider {
+	return &FakeProvider{
+		mode:     mode,
+		payments: make(map[string]*Result),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// SetMode switches the behaviour of subsequent calls.
+func (p *FakeProvider) SetMode(mode FakeMode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = mode
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	if err := p.simulate(ctx); err != nil {
+		return nil, err
+	}
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	res := &Result{Reference: fmt.Sprintf("fake_%d_%d", req.OrderID, p.seq), Amount: req.Amount}
+	if p.mode == FakeDecline {
+		res.Status = StatusDeclined
+		p.payments[res.Reference] = res
+		return copyResult(res), ErrDeclined
+	}
+	res.Status = StatusAuthorized
+	p.payments[res.Reference] = res
+	return copyResult(res), nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount float64) (*Result, error) {
+	return p.move(ctx, reference, amount, StatusAuthorized, StatusCaptured)
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, reference string, amount float64) (*Result, error) {
+	return p.move(ctx, reference, amount, StatusCaptured, StatusRefunded)
+}
+
+func (p *FakeProvider) Status(ctx context.Context, reference string) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res, ok := p.payments[reference]
+	if !ok {
+		return nil, ErrUnknownReference
+	}
+	return copyResult(res), nil
+}
+
+func (p *FakeProvider) move(ctx context.Context, reference string, amount float64, from, to Status) (*Result, error) {
+	if err := p.simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res, ok := p.payments[reference]
+	if !ok {
+		return nil, ErrUnknownReference
+	}
+	if res.Status != from {
+		return nil, fmt.Errorf("payment %s is %s, not %s", reference, res.Status, from)
+	}
+	if amount <= 0 || amount > res.Amount {
+		return nil, ErrInvalidAmount
+	}
+	res.Status = to
+	return copyResult(res), nil
+}
+
+// simulate blocks until ctx is done in timeout mode.
+func (p *FakeProvider) simulate(ctx context.Context) error {
+	p.mu.Lock()
+	mode := p.mode
+	p.mu.Unlock()
+
+	if mode == FakeTimeout {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return nil
+}
+
+func copyResult(res *Result) *Result {
+	c := *res
+	return &c
+}
@@ -0,0 +1,46 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+type Status string
+
+const (
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusDeclined   Status = "declined"
+	StatusRefunded   Status = "refunded"
+)
+
+var (
+	ErrDeclined         = errors.New("payment declined")
+	ErrTimeout          = errors.New("payment provider timed out")
+	ErrUnknownReference = errors.New("unknown payment reference")
+	ErrInvalidAmount    = errors.New("invalid payment amount")
+)
+
+type AuthorizeRequest struct {
+	OrderID  int
+	Amount   float64
+	Currency string
+}
+
+// Result is the provider's view of a payment after an operation.
+type Result struct {
+	Reference string
+	Status    Status
+	Amount    float64
+}
+
+// PaymentProvider is the seam between the order flow and a payment gateway.
+// Implementations must honour ctx cancellation and report declines with
+// ErrDeclined and gateway timeouts with ErrTimeout.
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, reference string, amount float64) (*Result, error)
+	Refund(ctx context.Context, reference string, amount float64) (*Result, error)
+	Status(ctx context.Context, reference string) (*Result, error)
+}
@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventPaymentDeclined = "payment.declined"
+	EventPaymentRefunded = "payment.refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleWebhook     = errors.New("webhook timestamp outside the accepted window")
+)
+
+// WebhookEvent is the payload a gateway posts to confirm a payment change.
+type WebhookEvent struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	OrderID   int     `json:"order_id"`
+	Reference string  `json:"reference"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" under secret, which is what SignatureHeader carries.
+func SignWebhookPayload(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the signature and rejects timestamps further
+// than tolerance from now in either direction, which bounds how long a
+// captured request could be replayed.
+func VerifyWebhookSignature(secret []byte, timestampHeader, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	if len(secret) == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := SignWebhookPayload(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrStaleWebhook
+	}
+	return nil
+}
+
+// SignedWebhook marshals event and returns the body together with the headers
+// a genuine gateway would send at time now. It is meant for tests and local
+// tooling that need to post valid sample webhooks.
+func SignedWebhook(secret []byte, event WebhookEvent, now time.Time) ([]byte, http.Header, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	timestamp := now.Unix()
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	headers.Set(SignatureHeader, SignWebhookPayload(secret, timestamp, body))
+	return body, headers, nil
+}
@@ -0,0 +1,55 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("whsec_test")
+	signedAt := time.Unix(1700000000, 0)
+	body, headers, err := SignedWebhook(secret, WebhookEvent{
+		ID:        "evt_1",
+		Type:      EventPaymentCaptured,
+		OrderID:   42,
+		Reference: "pay_1",
+		Amount:    19.99,
+	}, signedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := headers.Get(TimestampHeader)
+	signature := headers.Get(SignatureHeader)
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-2] ^= 1
+
+	const tolerance = 5 * time.Minute
+	tests := []struct {
+		name      string
+		secret    []byte
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		want      error
+	}{
+		{"valid", secret, timestamp, signature, body, signedAt.Add(time.Minute), nil},
+		{"clock skew within tolerance", secret, timestamp, signature, body, signedAt.Add(-time.Minute), nil},
+		{"stale timestamp", secret, timestamp, signature, body, signedAt.Add(tolerance + time.Second), ErrStaleWebhook},
+		{"timestamp from the future", secret, timestamp, signature, body, signedAt.Add(-tolerance - time.Second), ErrStaleWebhook},
+		{"tampered body", secret, timestamp, signature, tampered, signedAt, ErrInvalidSignature},
+		{"changed timestamp", secret, "1700000001", signature, body, signedAt, ErrInvalidSignature},
+		{"wrong secret", []byte("other"), timestamp, signature, body, signedAt, ErrInvalidSignature},
+		{"missing signature", secret, timestamp, "", body, signedAt, ErrInvalidSignature},
+		{"malformed timestamp", secret, "yesterday", signature, body, signedAt, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.secret, tt.timestamp, tt.signature, tt.body, tolerance, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
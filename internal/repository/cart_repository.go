@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type CartRepository interface {
+	GetOrCreateByUser(userID int) (*models.Cart, error)
+	GetOrCreateByToken(token string) (*models.Cart, error)
+	MergeGuestCart(token string, userID int) error
+	AddItem(cartID, productID, quantity int) error
+	SetItemQuantity(cartID, productID, quantity int) error
+	RemoveItem(cartID, productID int) error
+	Clear(cartID int) error
+}
+
+type cartRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewCartRepository(db *sql.DB, logger *zap.Logger) CartRepository {
+	return &cartRepository{db: db,
+		Log: logger}
+}
+
+// GetOrCreateByUser returns the user's cart with its items, creating an empty
+// cart on first use.
+func (r *cartRepository) GetOrCreateByUser(userID int) (*models.Cart, error) {
+	return r.getOrCreate(
+		`INSERT INTO carts (user_id) VALUES ($1)
+   ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+   RETURNING id, user_id, created_at, updated_at`,
+		userID,
+	)
+}
+
+// GetOrCreateByToken returns the guest cart identified by token, creating an
+// empty one on first use.
+func (r *cartRepository) GetOrCreateByToken(token string) (*models.Cart, error) {
+	return r.getOrCreate(
+		`INSERT INTO carts (token) VALUES ($1)
+   ON CONFLICT (token) DO UPDATE SET token = EXCLUDED.token
+   RETURNING id, user_id, created_at, updated_at`,
+		token,
+	)
+}
+
+func (r *cartRepository) getOrCreate(query string, owner any) (*models.Cart, error) {
+	cart := &models.Cart{}
+	var userID sql.NullInt64
+	err := r.db.QueryRow(query, owner).Scan(&cart.ID, &userID, &cart.CreatedAt, &cart.UpdatedAt)
+	if err != nil {
+		r.Log.Error("Failed to get or create cart", zap.Any("owner", owner), zap.Error(err))
+		return nil, fmt.Errorf("cartRepository.getOrCreate: %w", err)
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		cart.UserID = &id
+	}
+
+	if err := r.loadItems(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// MergeGuestCart moves the items of the guest cart identified by token into
+// the user's cart and deletes the guest cart. Quantities of products present in
+// both carts are added up but capped at the product's available stock; lines that are
+// already in the user's cart are never reduced. A missing guest cart is a no-op.
+func (r *cartRepository) MergeGuestCart(token string, userID int) error {
+	return inTx(r.db, r.Log, "cartRepository.MergeGuestCart", func(tx *sql.Tx) error {
+		var guestCartID int
+		err := tx.QueryRow("SELECT id FROM carts WHERE token = $1 AND user_id IS NULL FOR UPDATE", token).Scan(&guestCartID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			r.Log.Error("Failed to get guest cart", zap.Error(err))
+			return err
+		}
+
+		var userCartID int
+		err = tx.QueryRow(
+			`INSERT INTO carts (user_id) VALUES ($1)
+   ON CONFLICT (user_id) DO UPDATE SET updated_at = NOW()
+   RETURNING id`,
+			userID,
+		).Scan(&userCartID)
+		if err != nil {
+			r.Log.Error("Failed to get or create user cart", zap.Int("user_id", userID), zap.Error(err))
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO cart_items (cart_id, product_id, quantity)
+   SELECT $2, product_id, LEAST(quantity, available) FROM (
+       SELECT ci.product_id, ci.quantity, `+availableQuantitySQL+` AS available
+       FROM cart_items ci JOIN products p ON p.id = ci.product_id
+       WHERE ci.cart_id = $1) guest
+   WHERE available > 0
+   ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = GREATEST(
+       cart_items.quantity,
+       LEAST(cart_items.quantity + EXCLUDED.quantity,
+             (SELECT `+availableQuantitySQL+` FROM products p WHERE p.id = EXCLUDED.product_id)))`,
+			guestCartID, userCartID,
+		)
+		if err != nil {
+			r.Log.Error("Failed to merge cart items", zap.Int("guest_cart_id", guestCartID), zap.Int("user_cart_id", userCartID), zap.Error(err))
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM carts WHERE id = $1", guestCartID); err != nil {
+			r.Log.Error("Failed to delete guest cart", zap.Int("cart_id", guestCartID), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+func (r *cartRepository) loadItems(cart *models.Cart) error {
+	query := `SELECT ci.id, ci.cart_id, ci.product_id, p.name, p.price, ci.quantity, ` + availableQuantitySQL + `
+   FROM cart_items ci JOIN products p ON p.id = ci.product_id
+   WHERE ci.cart_id = $1 ORDER BY ci.id`
+	rows, err := r.db.Query(query, cart.ID)
+	if err != nil {
+		r.Log.Error("Failed to get cart items", zap.Error(err))
+		return errors.New("failed to get cart items")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	cart.Items = []models.CartItem{}
+	cart.Total = 0
+	for rows.Next() {
+		var item models.CartItem
+		if err := rows.Scan(&item.ID, &item.CartID, &item.ProductID, &item.Name, &item.Price, &item.Quantity, &item.Available); err != nil {
+			r.Log.Error("Failed to get cart items", zap.Error(err))
+			return errors.New("failed to get cart items")
+		}
+		item.LineTotal = item.Price * float64(item.Quantity)
+		cart.Total += item.LineTotal
+		cart.Items = append(cart.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get cart items", zap.Error(err))
+		return errors.New("failed to get cart items")
+	}
+	return nil
+}
+
+// AddItem adds quantity to the product's cart line, creating it if needed.
+func (r *cartRepository) AddItem(cartID, productID, quantity int) error {
+	_, err := r.db.Exec(
+		`INSERT INTO cart_items (cart_id, product_id, quantity) VALUES ($1, $2, $3)
+   ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity`,
+		cartID, productID, quantity,
+	)
+	if err != nil {
+		r.Log.Error("Failed to add cart item", zap.Int("cart_id", cartID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("cartRepository.AddItem: %w", err)
+	}
+	return r.touch(cartID)
+}
+
+func (r *cartRepository) SetItemQuantity(cartID, productID, quantity int) error {
+	res, err := r.db.Exec("UPDATE cart_items SET quantity = $3 WHERE cart_id = $1 AND product_id = $2", cartID, productID, quantity)
+	if err != nil {
+		r.Log.Error("Failed to update cart item", zap.Int("cart_id", cartID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("cartRepository.SetItemQuantity: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrCartItemNotFound
+	}
+	return r.touch(cartID)
+}
+
+func (r *cartRepository) RemoveItem(cartID, productID int) error {
+	res, err := r.db.Exec("DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2", cartID, productID)
+	if err != nil {
+		r.Log.Error("Failed to remove cart item", zap.Int("cart_id", cartID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("cartRepository.RemoveItem: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrCartItemNotFound
+	}
+	return r.touch(cartID)
+}
+
+func (r *cartRepository) Clear(cartID int) error {
+	if _, err := r.db.Exec("DELETE FROM cart_items WHERE cart_id = $1", cartID); err != nil {
+		r.Log.Error("Failed to clear cart", zap.Int("cart_id", cartID), zap.Error(err))
+		return fmt.Errorf("cartRepository.Clear: %w", err)
+	}
+	return r.touch(cartID)
+}
+
+func (r *cartRepository) touch(cartID int) error {
+	if _, err := r.db.Exec("UPDATE carts SET updated_at = NOW() WHERE id = $1", cartID); err != nil {
+		r.Log.Error("Failed to touch cart", zap.Int("cart_id", cartID), zap.Error(err))
+		return fmt.Errorf("cartRepository.touch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type CategoryRepository interface {
+	GetAll() ([]*models.Category, error)
+	GetById(id int) (*models.Category, error)
+	GetBySlug(slug string) (*models.Category, error)
+	Create(category *models.Category) error
+	Update(category *models.Category) error
+	Delete(id int) error
+	IsDescendant(id, ancestorID int) (bool, error)
+	AddProduct(categoryID, productID int) error
+	RemoveProduct(categoryID, productID int) error
+	GetProductsInTree(categoryID int) ([]*models.Product, error)
+}
+
+type categoryRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewCategoryRepository(db *sql.DB, logger *zap.Logger) CategoryRepository {
+	return &categoryRepository{db: db,
+		Log: logger}
+}
+
+func (r *categoryRepository) GetAll() ([]*models.Category, error) {
+	rows, err := r.db.Query("SELECT id, parent_id, name, slug, created_at FROM categories ORDER BY name, id")
+	if err != nil {
+		r.Log.Error("Failed to get categories", zap.Error(err))
+		return nil, errors.New("failed to get categories")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		category := &models.Category{}
+		var parentID sql.NullInt64
+		if err := rows.Scan(&category.ID, &parentID, &category.Name, &category.Slug, &category.CreatedAt); err != nil {
+			r.Log.Error("Failed to get categories", zap.Error(err))
+			return nil, errors.New("failed to get categories")
+		}
+		category.ParentID = nullableID(parentID)
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get categories", zap.Error(err))
+		return nil, errors.New("failed to get categories")
+	}
+	return categories, nil
+}
+
+func (r *categoryRepository) GetById(id int) (*models.Category, error) {
+	return r.getOne("id = $1", id)
+}
+
+func (r *categoryRepository) GetBySlug(slug string) (*models.Category, error) {
+	return r.getOne("slug = $1", slug)
+}
+
+func (r *categoryRepository) getOne(where string, arg any) (*models.Category, error) {
+	category := &models.Category{}
+	var parentID sql.NullInt64
+	err := r.db.QueryRow("SELECT id, parent_id, name, slug, created_at FROM categories WHERE "+where, arg).
+		Scan(&category.ID, &parentID, &category.Name, &category.Slug, &category.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrCategoryNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to get category", zap.Error(err))
+		return nil, errors.New("failed to get category")
+	}
+	category.ParentID = nullableID(parentID)
+	return category, nil
+}
+
+func (r *categoryRepository) Create(category *models.Category) error {
+	err := r.db.QueryRow(
+		"INSERT INTO categories (parent_id, name, slug) VALUES ($1, $2, $3) RETURNING id, created_at",
+		category.ParentID, category.Name, category.Slug,
+	).Scan(&category.ID, &category.CreatedAt)
+	if err != nil {
+		return r.writeError("categoryRepository.Create", err)
+	}
+	return nil
+}
+
+func (r *categoryRepository) Update(category *models.Category) error {
+	err := r.db.QueryRow(
+		"UPDATE categories SET parent_id = $1, name = $2, slug = $3 WHERE id = $4 RETURNING created_at",
+		category.ParentID, category.Name, category.Slug, category.ID,
+	).Scan(&category.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrCategoryNotFound
+	}
+	if err != nil {
+		return r.writeError("categoryRepository.Update", err)
+	}
+	return nil
+}
+
+// writeError maps constraint violations on categories to domain errors.
+func (r *categoryRepository) writeError(op string, err error) error {
+	switch {
+	case isPQError(err, pqUniqueViolation):
+		return models.ErrCategorySlugTaken
+	case isPQError(err, pqForeignKeyViolation):
+		return fmt.Errorf("parent: %w", models.ErrCategoryNotFound)
+	}
+	r.Log.Error("Failed to save category", zap.String("op", op), zap.Error(err))
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// Delete removes a category and its product links. Categories that still have
+// subcategories are refused with ErrCategoryHasChildren.
+func (r *categoryRepository) Delete(id int) error {
+	res, err := r.db.Exec("DELETE FROM categories WHERE id = $1", id)
+	if isPQError(err, pqForeignKeyViolation) {
+		return models.ErrCategoryHasChildren
+	}
+	if err != nil {
+		r.Log.Error("Failed to delete category", zap.Error(err))
+		return fmt.Errorf("categoryRepository.Delete: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrCategoryNotFound
+	}
+	return nil
+}
+
+// IsDescendant reports whether id lies in the subtree rooted at ancestorID,
+// the ancestor itself included.
+func (r *categoryRepository) IsDescendant(id, ancestorID int) (bool, error) {
+	query := `WITH RECURSIVE subtree AS (
+       SELECT id FROM categories WHERE id = $1
+       UNION
+       SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id)
+   SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`
+	var found bool
+	if err := r.db.QueryRow(query, ancestorID, id).Scan(&found); err != nil {
+		r.Log.Error("Failed to walk category tree", zap.Int("id", ancestorID), zap.Error(err))
+		return false, fmt.Errorf("categoryRepository.IsDescendant: %w", err)
+	}
+	return found, nil
+}
+
+func (r *categoryRepository) AddProduct(categoryID, productID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO product_categories (product_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		productID, categoryID,
+	)
+	if isPQError(err, pqForeignKeyViolation) {
+		if _, err := r.GetById(categoryID); err != nil {
+			return err
+		}
+		return models.ErrProductNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to link product to category", zap.Int("category_id", categoryID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("categoryRepository.AddProduct: %w", err)
+	}
+	return nil
+}
+
+func (r *categoryRepository) RemoveProduct(categoryID, productID int) error {
+	res, err := r.db.Exec("DELETE FROM product_categories WHERE product_id = $1 AND category_id = $2", productID, categoryID)
+	if err != nil {
+		r.Log.Error("Failed to unlink product from category", zap.Int("category_id", categoryID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("categoryRepository.RemoveProduct: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrProductNotFound
+	}
+	return nil
+}
+
+// GetProductsInTree returns every product linked to the category or to any of
+// its descendants, each product once.
+func (r *categoryRepository) GetProductsInTree(categoryID int) ([]*models.Product, error) {
+	query := `WITH RECURSIVE subtree AS (
+       SELECT id FROM categories WHERE id = $1
+       UNION
+       SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id)
+   SELECT ` + productColumns + `
+   FROM products p
+   WHERE p.archived_at IS NULL
+     AND EXISTS (SELECT 1 FROM product_categories pc JOIN subtree s ON s.id = pc.category_id WHERE pc.product_id = p.id)
+   ORDER BY p.name, p.id`
+	rows, err := r.db.Query(query, categoryID)
+	if err != nil {
+		r.Log.Error("Failed to get category products", zap.Int("category_id", categoryID), zap.Error(err))
+		return nil, errors.New("failed to get category products")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	products := []*models.Product{}
+	for rows.Next() {
+		product := &models.Product{}
+		if err := rows.Scan(productFields(product)...); err != nil {
+			r.Log.Error("Failed to get category products", zap.Error(err))
+			return nil, errors.New("failed to get category products")
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get category products", zap.Error(err))
+		return nil, errors.New("failed to get category products")
+	}
+	return products, nil
+}
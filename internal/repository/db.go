@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so repository methods that
+// accept it can run on their own or as part of a caller's transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// inTx runs fn inside a transaction, committing only if fn succeeds. Errors
+// are wrapped with op so callers can still match them with errors.Is.
+func inTx(db *sql.DB, log *zap.Logger, op string, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Failed to begin transaction", zap.String("op", op), zap.Error(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Error("Failed to rollback transaction", zap.String("op", op), zap.Error(err))
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error("Failed to commit transaction", zap.String("op", op), zap.Error(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// optionalID maps a non-positive ID to NULL for nullable reference columns.
+func optionalID(id int) *int {
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
+
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	v := int(id.Int64)
+	return &v
+}
+
+// isPQError reports whether err is a Postgres error with the given SQLSTATE code.
+func isPQError(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type IdempotencyRepository interface {
+	Begin(record *models.IdempotencyRecord) (*models.IdempotencyRecord, bool, error)
+	Complete(record *models.IdempotencyRecord) error
+	Release(record *models.IdempotencyRecord) error
+}
+
+type idempotencyRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewIdempotencyRepository(db *sql.DB, logger *zap.Logger) IdempotencyRepository {
+	return &idempotencyRepository{db: db,
+		Log: logger}
+}
+
+// Begin claims the key for a new request. It returns the claimed record and
+// true, or the record stored by an earlier request and false. Keys whose first
+// request was abandoned for over a minute, and keys older than a day, are
+// claimed afresh.
+func (r *idempotencyRepository) Begin(record *models.IdempotencyRecord) (*models.IdempotencyRecord, bool, error) {
+	err := r.db.QueryRow(
+		`INSERT INTO idempotency_keys (user_id, route, idempotency_key, request_hash)
+   VALUES ($1, $2, $3, $4)
+   ON CONFLICT (user_id, route, idempotency_key) DO UPDATE
+       SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = NULL,
+           response_body = NULL, created_at = NOW()
+       WHERE (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < NOW() - INTERVAL '1 minute')
+          OR idempotency_keys.created_at < NOW() - INTERVAL '24 hours'
+   RETURNING created_at`,
+		record.UserID, record.Route, record.Key, record.RequestHash,
+	).Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		r.Log.Error("Failed to claim idempotency key", zap.String("route", record.Route), zap.Error(err))
+		return nil, false, fmt.Errorf("idempotencyRepository.Begin: %w", err)
+	}
+
+	existing := &models.IdempotencyRecord{UserID: record.UserID, Route: record.Route, Key: record.Key}
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = r.db.QueryRow(
+		`SELECT request_hash, status_code, content_type, response_body, created_at
+   FROM idempotency_keys WHERE user_id = $1 AND route = $2 AND idempotency_key = $3`,
+		record.UserID, record.Route, record.Key,
+	).Scan(&existing.RequestHash, &status, &contentType, &existing.ResponseBody, &existing.CreatedAt)
+	if err != nil {
+		r.Log.Error("Failed to get idempotency key", zap.String("route", record.Route), zap.Error(err))
+		return nil, false, fmt.Errorf("idempotencyRepository.Begin: %w", err)
+	}
+	existing.StatusCode = int(status.Int64)
+	existing.ContentType = contentType.String
+	return existing, false, nil
+}
+
+// Complete stores the response of the request that claimed the key.
+func (r *idempotencyRepository) Complete(record *models.IdempotencyRecord) error {
+	_, err := r.db.Exec(
+		`UPDATE idempotency_keys SET status_code = $4, content_type = $5, response_body = $6
+   WHERE user_id = $1 AND route = $2 AND idempotency_key = $3`,
+		record.UserID, record.Route, record.Key, record.StatusCode, record.ContentType, record.ResponseBody,
+	)
+	if err != nil {
+		r.Log.Error("Failed to store idempotent response", zap.String("route", record.Route), zap.Error(err))
+		return fmt.Errorf("idempotencyRepository.Complete: %w", err)
+	}
+	return nil
+}
+
+// Release drops a claimed key so the client can retry, e.g. after a server error.
+func (r *idempotencyRepository) Release(record *models.IdempotencyRecord) error {
+	_, err := r.db.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND route = $2 AND idempotency_key = $3",
+		record.UserID, record.Route, record.Key,
+	)
+	if err != nil {
+		r.Log.Error("Failed to release idempotency key", zap.String("route", record.Route), zap.Error(err))
+		return fmt.Errorf("idempotencyRepository.Release: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+// ImageRepository stores product image metadata; the files themselves live in
+// a storage.BlobStore under StorageKey. URL is left for the caller to fill in.
+type ImageRepository interface {
+	GetByProduct(productID int) ([]*models.ProductImage, error)
+	GetByProducts(productIDs []int) (map[int][]*models.ProductImage, error)
+	Create(image *models.ProductImage) error
+	SetPrimary(productID, imageID int) error
+	Reorder(productID int, imageIDs []int) error
+	Delete(productID, imageID int) (*models.ProductImage, error)
+}
+
+type imageRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewImageRepository(db *sql.DB, logger *zap.Logger) ImageRepository {
+	return &imageRepository{db: db,
+		Log: logger}
+}
+
+const imageColumns = "id, product_id, storage_key, content_type, size_bytes, position, is_primary, created_at"
+
+func (r *imageRepository) GetByProduct(productID int) ([]*models.ProductImage, error) {
+	byProduct, err := r.GetByProducts([]int{productID})
+	if err != nil {
+		return nil, err
+	}
+	images := byProduct[productID]
+	if images == nil {
+		images = []*models.ProductImage{}
+	}
+	return images, nil
+}
+
+// GetByProducts loads the images of several products in one query, each list
+// in display order.
+func (r *imageRepository) GetByProducts(productIDs []int) (map[int][]*models.ProductImage, error) {
+	byProduct := make(map[int][]*models.ProductImage, len(productIDs))
+	if len(productIDs) == 0 {
+		return byProduct, nil
+	}
+	query := "SELECT " + imageColumns + " FROM product_images WHERE product_id = ANY($1) ORDER BY product_id, position, id"
+	rows, err := r.db.Query(query, pq.Array(productIDs))
+	if err != nil {
+		r.Log.Error("Failed to get product images", zap.Error(err))
+		return nil, errors.New("failed to get product images")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	for rows.Next() {
+		image := &models.ProductImage{}
+		if err := rows.Scan(&image.ID, &image.ProductID, &image.StorageKey, &image.ContentType, &image.Size,
+			&image.Position, &image.IsPrimary, &image.CreatedAt); err != nil {
+			r.Log.Error("Failed to get product images", zap.Error(err))
+			return nil, errors.New("failed to get product images")
+		}
+		byProduct[image.ProductID] = append(byProduct[image.ProductID], image)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get product images", zap.Error(err))
+		return nil, errors.New("failed to get product images")
+	}
+	return byProduct, nil
+}
+
+// Create appends the image after the product's existing images. The first
+// image of a product always becomes primary; a later one only if IsPrimary is
+// set, in which case it takes over from the previous primary image.
+func (r *imageRepository) Create(image *models.ProductImage) error {
+	return inTx(r.db, r.Log, "imageRepository.Create", func(tx *sql.Tx) error {
+		var locked int
+		err := tx.QueryRow("SELECT id FROM products WHERE id = $1 FOR UPDATE", image.ProductID).Scan(&locked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrProductNotFound
+		}
+		if err != nil {
+			r.Log.Error("Failed to lock product for image", zap.Int("product_id", image.ProductID), zap.Error(err))
+			return err
+		}
+
+		var count, maxPosition int
+		err = tx.QueryRow("SELECT COUNT(*), COALESCE(MAX(position), -1) FROM product_images WHERE product_id = $1", image.ProductID).
+			Scan(&count, &maxPosition)
+		if err != nil {
+			r.Log.Error("Failed to get image positions", zap.Int("product_id", image.ProductID), zap.Error(err))
+			return err
+		}
+		image.Position = maxPosition + 1
+		image.IsPrimary = image.IsPrimary || count == 0
+		if image.IsPrimary {
+			if _, err := tx.Exec("UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary", image.ProductID); err != nil {
+				r.Log.Error("Failed to clear primary image", zap.Int("product_id", image.ProductID), zap.Error(err))
+				return err
+			}
+		}
+
+		err = tx.QueryRow(
+			`INSERT INTO product_images (product_id, storage_key, content_type, size_bytes, position, is_primary)
+   VALUES ($1,$2,$3,$4,$5,$6) RETURNING id, created_at`,
+			image.ProductID, image.StorageKey, image.ContentType, image.Size, image.Position, image.IsPrimary,
+		).Scan(&image.ID, &image.CreatedAt)
+		if err != nil {
+			r.Log.Error("Failed to insert product image", zap.Int("product_id", image.ProductID), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+func (r *imageRepository) SetPrimary(productID, imageID int) error {
+	return inTx(r.db, r.Log, "imageRepository.SetPrimary", func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary", productID); err != nil {
+			r.Log.Error("Failed to clear primary image", zap.Int("product_id", productID), zap.Error(err))
+			return err
+		}
+		res, err := tx.Exec("UPDATE product_images SET is_primary = TRUE WHERE id = $1 AND product_id = $2", imageID, productID)
+		if err != nil {
+			r.Log.Error("Failed to set primary image", zap.Int("id", imageID), zap.Error(err))
+			return err
+		}
+		rows, _ := res.RowsAffected()
+		if rows == 0 {
+			return models.ErrImageNotFound
+		}
+		return nil
+	})
+}
+
+// Reorder sets the display order of the product's images. imageIDs must list
+// every image of the product exactly once.
+func (r *imageRepository) Reorder(productID int, imageIDs []int) error {
+	return inTx(r.db, r.Log, "imageRepository.Reorder", func(tx *sql.Tx) error {
+		var count int
+		err := tx.QueryRow(
+			`SELECT COUNT(*) FROM product_images WHERE product_id = $1 AND id = ANY($2)`,
+			productID, pq.Array(imageIDs),
+		).Scan(&count)
+		if err != nil {
+			r.Log.Error("Failed to check product images", zap.Int("product_id", productID), zap.Error(err))
+			return err
+		}
+		var total int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM product_images WHERE product_id = $1", productID).Scan(&total); err != nil {
+			r.Log.Error("Failed to count product images", zap.Int("product_id", productID), zap.Error(err))
+			return err
+		}
+		if count != len(imageIDs) || count != total {
+			return fmt.Errorf("image_ids must list every image of product %d once: %w", productID, models.ErrInvalidImageOrder)
+		}
+
+		_, err = tx.Exec(
+			`UPDATE product_images pi SET position = o.position - 1
+   FROM unnest($2::int[]) WITH ORDINALITY AS o(id, position)
+   WHERE pi.id = o.id AND pi.product_id = $1`,
+			productID, pq.Array(imageIDs),
+		)
+		if err != nil {
+			r.Log.Error("Failed to reorder product images", zap.Int("product_id", productID), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// Delete removes the image row and returns it so the caller can delete the
+// stored file. If it was the primary image, the next image in order becomes
+// primary.
+func (r *imageRepository) Delete(productID, imageID int) (*models.ProductImage, error) {
+	image := &models.ProductImage{}
+	err := inTx(r.db, r.Log, "imageRepository.Delete", func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			"DELETE FROM product_images WHERE id = $1 AND product_id = $2 RETURNING "+imageColumns,
+			imageID, productID,
+		).Scan(&image.ID, &image.ProductID, &image.StorageKey, &image.ContentType, &image.Size,
+			&image.Position, &image.IsPrimary, &image.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrImageNotFound
+		}
+		if err != nil {
+			r.Log.Error("Failed to delete product image", zap.Int("id", imageID), zap.Error(err))
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+		_, err = tx.Exec(
+			`UPDATE product_images SET is_primary = TRUE WHERE id = (
+       SELECT id FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1)`,
+			productID,
+		)
+		if err != nil {
+			r.Log.Error("Failed to promote primary image", zap.Int("product_id", productID), zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
@@ -0,0 +1,407 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type OrderRepository interface {
+	CreateOrder(order *models.Orders, items []models.OrderItemRequest) error
+	GetOrdersByUser(userID int) ([]*models.Orders, error)
+	GetOrderById(id int) (*models.Orders, error)
+	GetAllOrders(status string) ([]*models.Orders, error)
+	UpdateStatus(orderID int, from, to string, actorID int, beforeCommit func(DBTX) error) error
+	MarkPaid(orderID int, from string, actorID int) error
+	CancelOrder(orderID int, from string, actorID int, beforeCommit func(DBTX) error) error
+	GetStatusHistory(orderID int) ([]*models.OrderStatusHistory, error)
+}
+
+type orderRepository struct {
+	db              *sql.DB
+	productRepo     ProductRepo
+	reservationRepo ReservationRepository
+	Log             *zap.Logger
+}
+
+func NewOrderRepository(db *sql.DB, productRepo ProductRepo, reservationRepo ReservationRepository, logger *zap.Logger) OrderRepository {
+	return &orderRepository{db: db,
+		productRepo:     productRepo,
+		reservationRepo: reservationRepo,
+		Log:             logger}
+}
+
+// CreateOrder inserts the order and its items, snapshots the current product
+// or variant prices and places stock reservations for every item in a single
+// transaction. Stock is only taken from product or variant quantity once the
+// order is paid.
+func (r *orderRepository) CreateOrder(order *models.Orders, items []models.OrderItemRequest) error {
+	return inTx(r.db, r.Log, "orderRepository.CreateOrder", func(tx *sql.Tx) error {
+		err := tx.QueryRow("INSERT INTO orders (user_id) VALUES ($1) RETURNING id, status, created_at", order.UserId).
+			Scan(&order.ID, &order.Status, &order.CreatedAt)
+		if err != nil {
+			r.Log.Error("Failed to insert order", zap.Error(err))
+			return err
+		}
+		if err := r.insertHistory(tx, order.ID, nil, order.Status, order.UserId); err != nil {
+			return err
+		}
+
+		order.Items = make([]models.OrderItem, 0, len(items))
+		order.Total = 0
+		for _, item := range items {
+			price, err := r.itemPrice(tx, item)
+			if err != nil {
+				return err
+			}
+			if err := r.reservationRepo.Reserve(tx, order.ID, item.ProductID, item.VariantID, item.Quantity); err != nil {
+				return err
+			}
+
+			orderItem := models.OrderItem{
+				OrderID:   order.ID,
+				ProductID: item.ProductID,
+				VariantID: optionalID(item.VariantID),
+				Quantity:  item.Quantity,
+				Price:     price,
+			}
+			err = tx.QueryRow(
+				`INSERT INTO order_items (order_id, product_id, variant_id, quantity, price)
+   VALUES ($1,$2,$3,$4,$5) RETURNING id`,
+				orderItem.OrderID, orderItem.ProductID, orderItem.VariantID, orderItem.Quantity, orderItem.Price,
+			).Scan(&orderItem.ID)
+			if err != nil {
+				r.Log.Error("Failed to insert order item", zap.Error(err))
+				return err
+			}
+			order.Items = append(order.Items, orderItem)
+			order.Total += orderItem.Price * float64(orderItem.Quantity)
+		}
+		return nil
+	})
+}
+
+// itemPrice returns the current price of the ordered product, or of its
+// variant, falling back to the product price when the variant has none.
+func (r *orderRepository) itemPrice(tx *sql.Tx, item models.OrderItemRequest) (float64, error) {
+	var price float64
+	if item.VariantID > 0 {
+		err := tx.QueryRow(
+			`SELECT COALESCE(v.price, p.price) FROM product_variants v JOIN products p ON p.id = v.product_id
+   WHERE v.id = $1 AND v.product_id = $2 AND p.archived_at IS NULL`,
+			item.VariantID, item.ProductID,
+		).Scan(&price)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("variant %d of product %d: %w", item.VariantID, item.ProductID, models.ErrVariantNotFound)
+		}
+		if err != nil {
+			r.Log.Error("Failed to get variant price", zap.Int("variant_id", item.VariantID), zap.Error(err))
+			return 0, err
+		}
+		return price, nil
+	}
+
+	err := tx.QueryRow("SELECT price FROM products WHERE id = $1 AND archived_at IS NULL", item.ProductID).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("product %d: %w", item.ProductID, models.ErrProductNotFound)
+	}
+	if err != nil {
+		r.Log.Error("Failed to get product price", zap.Int("product_id", item.ProductID), zap.Error(err))
+		return 0, err
+	}
+	return price, nil
+}
+
+func (r *orderRepository) GetOrdersByUser(userID int) ([]*models.Orders, error) {
+	query := "SELECT id, user_id, status, created_at FROM orders WHERE user_id = $1 ORDER BY created_at DESC, id DESC"
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		r.Log.Error("Failed to get orders by user", zap.Error(err))
+		return nil, errors.New("failed to get orders")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	orders := []*models.Orders{}
+	byID := make(map[int]*models.Orders)
+	for rows.Next() {
+		order := &models.Orders{Items: []models.OrderItem{}}
+		if err := rows.Scan(&order.ID, &order.UserId, &order.Status, &order.CreatedAt); err != nil {
+			r.Log.Error("Failed to get orders by user", zap.Error(err))
+			return nil, errors.New("failed to get orders")
+		}
+		orders = append(orders, order)
+		byID[order.ID] = order
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get orders by user", zap.Error(err))
+		return nil, errors.New("failed to get orders")
+	}
+
+	itemsQuery := `SELECT oi.id, oi.order_id, oi.product_id, oi.variant_id, oi.quantity, oi.price
+   FROM order_items oi JOIN orders o ON o.id = oi.order_id
+   WHERE o.user_id = $1 ORDER BY oi.id`
+	if err := r.loadItems(byID, itemsQuery, userID); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *orderRepository) GetOrderById(id int) (*models.Orders, error) {
+	order := &models.Orders{Items: []models.OrderItem{}}
+	query := "SELECT id, user_id, status, created_at FROM orders WHERE id = $1"
+	err := r.db.QueryRow(query, id).Scan(&order.ID, &order.UserId, &order.Status, &order.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrOrderNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to get order by ID", zap.Error(err))
+		return nil, errors.New("failed to get order")
+	}
+
+	itemsQuery := "SELECT id, order_id, product_id, variant_id, quantity, price FROM order_items WHERE order_id = $1 ORDER BY id"
+	if err := r.loadItems(map[int]*models.Orders{order.ID: order}, itemsQuery, id); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *orderRepository) GetAllOrders(status string) ([]*models.Orders, error) {
+	query := "SELECT id, user_id, status, created_at FROM orders WHERE ($1 = '' OR status = $1) ORDER BY created_at DESC, id DESC"
+	rows, err := r.db.Query(query, status)
+	if err != nil {
+		r.Log.Error("Failed to get all orders", zap.Error(err))
+		return nil, errors.New("failed to get all orders")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	orders := []*models.Orders{}
+	byID := make(map[int]*models.Orders)
+	for rows.Next() {
+		order := &models.Orders{Items: []models.OrderItem{}}
+		if err := rows.Scan(&order.ID, &order.UserId, &order.Status, &order.CreatedAt); err != nil {
+			r.Log.Error("Failed to get all orders", zap.Error(err))
+			return nil, errors.New("failed to get all orders")
+		}
+		orders = append(orders, order)
+		byID[order.ID] = order
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get all orders", zap.Error(err))
+		return nil, errors.New("failed to get all orders")
+	}
+
+	itemsQuery := `SELECT oi.id, oi.order_id, oi.product_id, oi.variant_id, oi.quantity, oi.price
+   FROM order_items oi JOIN orders o ON o.id = oi.order_id
+   WHERE ($1 = '' OR o.status = $1) ORDER BY oi.id`
+	if err := r.loadItems(byID, itemsQuery, status); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// UpdateStatus moves the order from one status to another and records the
+// change in order_status_history. beforeCommit, if set, runs last in the same
+// transaction while the order row is locked; an error from it rolls the change
+// back.
+func (r *orderRepository) UpdateStatus(orderID int, from, to string, actorID int, beforeCommit func(DBTX) error) error {
+	return inTx(r.db, r.Log, "orderRepository.UpdateStatus", func(tx *sql.Tx) error {
+		if err := r.changeStatus(tx, orderID, from, to, actorID); err != nil {
+			return err
+		}
+		if beforeCommit != nil {
+			return beforeCommit(tx)
+		}
+		return nil
+	})
+}
+
+// MarkPaid flips the order to paid and commits its stock reservations in the
+// same transaction, so a paid order always has its stock taken.
+func (r *orderRepository) MarkPaid(orderID int, from string, actorID int) error {
+	return inTx(r.db, r.Log, "orderRepository.MarkPaid", func(tx *sql.Tx) error {
+		if err := r.changeStatus(tx, orderID, from, models.OrderStatusPaid, actorID); err != nil {
+			return err
+		}
+		return r.reservationRepo.Commit(tx, orderID, actorID)
+	})
+}
+
+// CancelOrder flips the order to cancelled in one transaction with giving its
+// stock back: active reservations are released, and stock that was already
+// taken (paid orders, or orders placed before reservations existed) is
+// returned to product quantity. beforeCommit works as in UpdateStatus.
+func (r *orderRepository) CancelOrder(orderID int, from string, actorID int, beforeCommit func(DBTX) error) error {
+	return inTx(r.db, r.Log, "orderRepository.CancelOrder", func(tx *sql.Tx) error {
+		if err := r.changeStatus(tx, orderID, from, models.OrderStatusCancelled, actorID); err != nil {
+			return err
+		}
+		released, err := r.reservationRepo.Release(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if from == models.OrderStatusPending && released > 0 {
+			if beforeCommit != nil {
+				return beforeCommit(tx)
+			}
+			return nil
+		}
+
+		rows, err := tx.Query("SELECT product_id, COALESCE(variant_id, 0), quantity FROM order_items WHERE order_id = $1 ORDER BY product_id, variant_id", orderID)
+		if err != nil {
+			r.Log.Error("Failed to get order items for restock", zap.Int("order_id", orderID), zap.Error(err))
+			return err
+		}
+		var items []models.OrderItemRequest
+		for rows.Next() {
+			var item models.OrderItemRequest
+			if err := rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity); err != nil {
+				_ = rows.Close()
+				r.Log.Error("Failed to get order items for restock", zap.Int("order_id", orderID), zap.Error(err))
+				return err
+			}
+			items = append(items, item)
+		}
+		if err := rows.Close(); err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+		if err := rows.Err(); err != nil {
+			r.Log.Error("Failed to get order items for restock", zap.Int("order_id", orderID), zap.Error(err))
+			return err
+		}
+
+		for _, item := range items {
+			err := r.productRepo.AdjustStock(tx, &models.StockMovement{
+				ProductID: item.ProductID,
+				VariantID: optionalID(item.VariantID),
+				Delta:     item.Quantity,
+				Reason:    models.StockReasonCancellation,
+				OrderID:   &orderID,
+				ActorID:   optionalID(actorID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if beforeCommit != nil {
+			return beforeCommit(tx)
+		}
+		return nil
+	})
+}
+
+// changeStatus updates the order status conditionally on its current value,
+// so concurrent transitions cannot both succeed, and appends a history row.
+func (r *orderRepository) changeStatus(tx *sql.Tx, orderID int, from, to string, actorID int) error {
+	res, err := tx.Exec("UPDATE orders SET status = $1 WHERE id = $2 AND status = $3", to, orderID, from)
+	if err != nil {
+		r.Log.Error("Failed to update order status", zap.Int("id", orderID), zap.Error(err))
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("order %d is no longer %s: %w", orderID, from, models.ErrInvalidTransition)
+	}
+	return r.insertHistory(tx, orderID, &from, to, actorID)
+}
+
+func (r *orderRepository) insertHistory(tx *sql.Tx, orderID int, from *string, to string, actorID int) error {
+	var changedBy sql.NullInt64
+	if actorID > 0 {
+		changedBy = sql.NullInt64{Int64: int64(actorID), Valid: true}
+	}
+	_, err := tx.Exec(
+		"INSERT INTO order_status_history (order_id, from_status, to_status, changed_by) VALUES ($1, $2, $3, $4)",
+		orderID, from, to, changedBy,
+	)
+	if err != nil {
+		r.Log.Error("Failed to insert order status history", zap.Int("order_id", orderID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *orderRepository) GetStatusHistory(orderID int) ([]*models.OrderStatusHistory, error) {
+	query := "SELECT id, order_id, from_status, to_status, changed_by, created_at FROM order_status_history WHERE order_id = $1 ORDER BY created_at, id"
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		r.Log.Error("Failed to get order status history", zap.Error(err))
+		return nil, errors.New("failed to get order status history")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	history := []*models.OrderStatusHistory{}
+	for rows.Next() {
+		entry := &models.OrderStatusHistory{}
+		var from sql.NullString
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&entry.ID, &entry.OrderID, &from, &entry.ToStatus, &changedBy, &entry.CreatedAt); err != nil {
+			r.Log.Error("Failed to get order status history", zap.Error(err))
+			return nil, errors.New("failed to get order status history")
+		}
+		if from.Valid {
+			entry.FromStatus = &from.String
+		}
+		if changedBy.Valid {
+			actor := int(changedBy.Int64)
+			entry.ChangedBy = &actor
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get order status history", zap.Error(err))
+		return nil, errors.New("failed to get order status history")
+	}
+	return history, nil
+}
+
+// loadItems runs an order_items query and attaches each row to its order,
+// accumulating the order total along the way.
+func (r *orderRepository) loadItems(orders map[int]*models.Orders, query string, args ...any) error {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.Log.Error("Failed to get order items", zap.Error(err))
+		return errors.New("failed to get order items")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	for rows.Next() {
+		var item models.OrderItem
+		var variantID sql.NullInt64
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &variantID, &item.Quantity, &item.Price); err != nil {
+			r.Log.Error("Failed to get order items", zap.Error(err))
+			return errors.New("failed to get order items")
+		}
+		item.VariantID = nullableID(variantID)
+		if order, ok := orders[item.OrderID]; ok {
+			order.Items = append(order.Items, item)
+			order.Total += item.Price * float64(item.Quantity)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get order items", zap.Error(err))
+		return errors.New("failed to get order items")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type PaymentRepository interface {
+	Create(payment *models.Payment) error
+	Update(payment *models.Payment) error
+	MarkRefunded(q DBTX, id int) error
+	GetByOrder(orderID int) ([]*models.Payment, error)
+	GetCapturedByOrder(orderID int) (*models.Payment, error)
+	GetByProviderRef(provider, ref string) (*models.Payment, error)
+	RecordWebhookEvent(eventID, eventType string) (bool, error)
+	ForgetWebhookEvent(eventID string) error
+}
+
+type paymentRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewPaymentRepository(db *sql.DB, logger *zap.Logger) PaymentRepository {
+	return &paymentRepository{db: db,
+		Log: logger}
+}
+
+const paymentColumns = "id, order_id, provider, COALESCE(provider_ref, ''), amount, status, COALESCE(error, ''), created_at, updated_at"
+
+func scanPayment(row interface{ Scan(...any) error }, p *models.Payment) error {
+	return row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.ProviderRef, &p.Amount, &p.Status, &p.Error, &p.CreatedAt, &p.UpdatedAt)
+}
+
+func (r *paymentRepository) Create(payment *models.Payment) error {
+	err := r.db.QueryRow(
+		`INSERT INTO payments (order_id, provider, provider_ref, amount, status, error)
+   VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, '')) RETURNING id, created_at, updated_at`,
+		payment.OrderID, payment.Provider, payment.ProviderRef, payment.Amount, payment.Status, payment.Error,
+	).Scan(&payment.ID, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		r.Log.Error("Failed to insert payment", zap.Int("order_id", payment.OrderID), zap.Error(err))
+		return fmt.Errorf("paymentRepository.Create: %w", err)
+	}
+	return nil
+}
+
+func (r *paymentRepository) Update(payment *models.Payment) error {
+	err := r.db.QueryRow(
+		`UPDATE payments SET provider_ref = NULLIF($2, ''), status = $3, error = NULLIF($4, ''), updated_at = NOW()
+   WHERE id = $1 RETURNING updated_at`,
+		payment.ID, payment.ProviderRef, payment.Status, payment.Error,
+	).Scan(&payment.UpdatedAt)
+	if err != nil {
+		r.Log.Error("Failed to update payment", zap.Int("id", payment.ID), zap.Error(err))
+		return fmt.Errorf("paymentRepository.Update: %w", err)
+	}
+	return nil
+}
+
+// MarkRefunded moves a captured payment to refunded. A payment that is no
+// longer captured is left alone and reported with ErrPaymentNotCaptured. Pass
+// a *sql.Tx as q to record the refund with other changes, or nil.
+func (r *paymentRepository) MarkRefunded(q DBTX, id int) error {
+	if q == nil {
+		q = r.db
+	}
+	res, err := q.Exec(
+		"UPDATE payments SET status = $2, error = NULL, updated_at = NOW() WHERE id = $1 AND status = $3",
+		id, models.PaymentStatusRefunded, models.PaymentStatusCaptured,
+	)
+	if err != nil {
+		r.Log.Error("Failed to mark payment refunded", zap.Int("id", id), zap.Error(err))
+		return fmt.Errorf("paymentRepository.MarkRefunded: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrPaymentNotCaptured
+	}
+	return nil
+}
+
+func (r *paymentRepository) GetByOrder(orderID int) ([]*models.Payment, error) {
+	query := "SELECT " + paymentColumns + " FROM payments WHERE order_id = $1 ORDER BY created_at, id"
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		r.Log.Error("Failed to get payments", zap.Error(err))
+		return nil, errors.New("failed to get payments")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	payments := []*models.Payment{}
+	for rows.Next() {
+		p := &models.Payment{}
+		if err := scanPayment(rows, p); err != nil {
+			r.Log.Error("Failed to get payments", zap.Error(err))
+			return nil, errors.New("failed to get payments")
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get payments", zap.Error(err))
+		return nil, errors.New("failed to get payments")
+	}
+	return payments, nil
+}
+
+// GetCapturedByOrder returns the latest captured payment of the order, or nil
+// if the order has none.
+func (r *paymentRepository) GetCapturedByOrder(orderID int) (*models.Payment, error) {
+	p := &models.Payment{}
+	query := "SELECT " + paymentColumns + " FROM payments WHERE order_id = $1 AND status = 'captured' ORDER BY created_at DESC, id DESC LIMIT 1"
+	err := scanPayment(r.db.QueryRow(query, orderID), p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		r.Log.Error("Failed to get captured payment", zap.Int("order_id", orderID), zap.Error(err))
+		return nil, errors.New("failed to get captured payment")
+	}
+	return p, nil
+}
+
+// GetByProviderRef returns the payment the provider knows as ref, or nil.
+func (r *paymentRepository) GetByProviderRef(provider, ref string) (*models.Payment, error) {
+	p := &models.Payment{}
+	query := "SELECT " + paymentColumns + " FROM payments WHERE provider = $1 AND provider_ref = $2"
+	err := scanPayment(r.db.QueryRow(query, provider, ref), p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		r.Log.Error("Failed to get payment by provider reference", zap.String("ref", ref), zap.Error(err))
+		return nil, errors.New("failed to get payment")
+	}
+	return p, nil
+}
+
+// RecordWebhookEvent stores the event ID and reports whether it is new. A
+// false result means the event was seen before and must not be applied again.
+func (r *paymentRepository) RecordWebhookEvent(eventID, eventType string) (bool, error) {
+	res, err := r.db.Exec(
+		"INSERT INTO webhook_events (event_id, event_type) VALUES ($1, $2) ON CONFLICT (event_id) DO NOTHING",
+		eventID, eventType,
+	)
+	if err != nil {
+		r.Log.Error("Failed to record webhook event", zap.String("event_id", eventID), zap.Error(err))
+		return false, fmt.Errorf("paymentRepository.RecordWebhookEvent: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	return rows > 0, nil
+}
+
+// ForgetWebhookEvent removes a recorded event so that the gateway's retry of
+// an event that failed to apply is not mistaken for a replay.
+func (r *paymentRepository) ForgetWebhookEvent(eventID string) error {
+	if _, err := r.db.Exec("DELETE FROM webhook_events WHERE event_id = $1", eventID); err != nil {
+		r.Log.Error("Failed to forget webhook event", zap.String("event_id", eventID), zap.Error(err))
+		return fmt.Errorf("paymentRepository.ForgetWebhookEvent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"strings"
+)
+
+// lowStockThreshold is the available quantity at or below which a product
+// counts as low stock.
+const lowStockThreshold = 5
+
+// FacetBucket is one bucket of a product facet. Cond is a constant SQL
+// condition on products aliased as p; it must not take bind parameters.
+type FacetBucket struct {
+	Key  string
+	Cond string
+}
+
+type productFacet struct {
+	name    string
+	buckets []FacetBucket
+}
+
+var productFacets []productFacet
+
+// RegisterProductFacet adds a facet to every product listing. Facets are
+// reported in registration order; attributes added to products later can
+// register their own facets the same way the built-in ones below do.
+func RegisterProductFacet(name string, buckets ...FacetBucket) {
+	productFacets = append(productFacets, productFacet{name: name, buckets: buckets})
+}
+
+func init() {
+	RegisterProductFacet("price",
+		FacetBucket{Key: "0-25", Cond: "p.price < 25"},
+		FacetBucket{Key: "25-50", Cond: "p.price >= 25 AND p.price < 50"},
+		FacetBucket{Key: "50-100", Cond: "p.price >= 50 AND p.price < 100"},
+		FacetBucket{Key: "100-250", Cond: "p.price >= 100 AND p.price < 250"},
+		FacetBucket{Key: "250+", Cond: "p.price >= 250"},
+	)
+	RegisterProductFacet("availability",
+		FacetBucket{Key: "in_stock", Cond: fmt.Sprintf("%s > %d", availableQuantitySQL, lowStockThreshold)},
+		FacetBucket{Key: "low_stock", Cond: fmt.Sprintf("%s BETWEEN 1 AND %d", availableQuantitySQL, lowStockThreshold)},
+		FacetBucket{Key: "sold_out", Cond: availableQuantitySQL + " = 0"},
+	)
+	RegisterProductFacet("created",
+		FacetBucket{Key: "last_7_days", Cond: "p.created_at >= NOW() - INTERVAL '7 days'"},
+		FacetBucket{Key: "last_30_days", Cond: "p.created_at >= NOW() - INTERVAL '30 days'"},
+		FacetBucket{Key: "last_year", Cond: "p.created_at >= NOW() - INTERVAL '1 year'"},
+		FacetBucket{Key: "older", Cond: "p.created_at < NOW() - INTERVAL '1 year'"},
+	)
+}
+
+// GetFacets counts, in a single pass over the products matching the filter,
+// how many fall into each bucket of every registered facet. Pagination fields
+// of the filter are ignored.
+func (r *productRepo) GetFacets(filter *models.ProductFilter) ([]*models.Facet, error) {
+	var counts []string
+	for _, facet := range productFacets {
+		for _, bucket := range facet.buckets {
+			counts = append(counts, "COUNT(*) FILTER (WHERE "+bucket.Cond+")")
+		}
+	}
+	if len(counts) == 0 {
+		return []*models.Facet{}, nil
+	}
+
+	f := productFilterSQL(filter)
+	values := make([]int, len(counts))
+	dest := make([]any, len(counts))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	query := "SELECT " + strings.Join(counts, ", ") + " FROM products p" + f.clause()
+	if err := r.db.QueryRow(query, f.args...).Scan(dest...); err != nil {
+		r.Log.Error("Failed to count product facets", zap.Error(err))
+		return nil, errors.New("failed to count product facets")
+	}
+
+	facets := make([]*models.Facet, 0, len(productFacets))
+	i := 0
+	for _, facet := range productFacets {
+		result := &models.Facet{Name: facet.name, Buckets: make([]models.FacetBucket, 0, len(facet.buckets))}
+		for _, bucket := range facet.buckets {
+			result.Buckets = append(result.Buckets, models.FacetBucket{Key: bucket.Key, Count: values[i]})
+			i++
+		}
+		facets = append(facets, result)
+	}
+	return facets, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mystore/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlFilter collects WHERE conditions together with their positional
+// arguments, so every value reaches Postgres as a bind parameter.
+type sqlFilter struct {
+	conds []string
+	args  []any
+}
+
+// arg registers v and returns its placeholder.
+func (f *sqlFilter) arg(v any) string {
+	f.args = append(f.args, v)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+func (f *sqlFilter) where(cond string) {
+	f.conds = append(f.conds, cond)
+}
+
+func (f *sqlFilter) clause() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// productFilterSQL translates the filter fields shared by every product
+// listing into conditions on products aliased as p. Archived products are
+// always left out. Pagination and sorting are left to the caller.
+func productFilterSQL(filter *models.ProductFilter) *sqlFilter {
+	f := &sqlFilter{}
+	f.where("p.archived_at IS NULL")
+	if filter.MinPrice != nil {
+		f.where("p.price >= " + f.arg(*filter.MinPrice))
+	}
+	if filter.MaxPrice != nil {
+		f.where("p.price <= " + f.arg(*filter.MaxPrice))
+	}
+	if filter.InStock {
+		f.where(availableQuantitySQL + " > 0")
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		f.where("p.name ILIKE " + f.arg("%"+escapeLike(q)+"%"))
+	}
+	return f
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// productSort resolves a ProductFilter sort into its column and direction.
+func productSort(sort string) (column string, desc bool) {
+	desc = strings.HasPrefix(sort, "-")
+	switch strings.TrimPrefix(sort, "-") {
+	case models.ProductSortPrice:
+		return "p.price", desc
+	case models.ProductSortName:
+		return "p.name", desc
+	case models.ProductSortCreatedAt:
+		return "p.created_at", desc
+	default:
+		return "p.created_at", true
+	}
+}
+
+// productCursor is the keyset position after the last product of a page: the
+// value of the sort column and the product ID as tie-breaker.
+type productCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeProductCursor(sort string, p *models.Product) string {
+	c := productCursor{Sort: sort, ID: p.ID}
+	switch column, _ := productSort(sort); column {
+	case "p.price":
+		c.Value = strconv.FormatFloat(p.Price, 'f', -1, 64)
+	case "p.name":
+		c.Value = p.Name
+	default:
+		c.Value = p.CreatedAt.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(raw, sort string) (*productCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, models.ErrInvalidCursor
+	}
+	var c productCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, models.ErrInvalidCursor
+	}
+	if c.Sort != sort {
+		return nil, fmt.Errorf("cursor was issued for sort %q: %w", c.Sort, models.ErrInvalidCursor)
+	}
+	return &c, nil
+}
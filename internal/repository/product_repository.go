@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"mystore/internal/models"
 
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -15,11 +17,28 @@ type productRepo struct {
 }
 
 type ProductRepo interface {
-	GetAllProduct() ([]*models.Product, error)
+	ListProducts(filter *models.ProductFilter) (*models.ProductPage, error)
+	GetFacets(filter *models.ProductFilter) ([]*models.Facet, error)
+	StreamProducts(ctx context.Context, filter *models.ProductFilter, fn func(*models.Product) error) error
+	SearchProducts(query string, limit int) ([]*models.ProductSearchResult, error)
+	SimilarProducts(query string, limit int) ([]*models.ProductSearchResult, error)
 	GetById(id int) (*models.Product, error)
-	Create(product *models.Product) error
-	Update(product *models.Product) error
+	GetByIds(ids []int) ([]*models.Product, error)
+	Create(product *models.Product, actorID int) error
+	Update(product *models.Product, actorID int) error
+	UpsertBySKU(products []*models.Product, actorID int, atomic bool) ([]UpsertResult, error)
 	Delete(id int) error
+	AdjustStock(q DBTX, movement *models.StockMovement) error
+	GetStockHistory(productID int) ([]*models.StockMovement, error)
+	Reconcile(productID int) (*models.StockReconciliation, error)
+}
+
+// productColumns selects a product with its available quantity, in the order
+// productFields scans them. It expects products aliased as p.
+const productColumns = "p.id, COALESCE(p.sku, ''), p.name, p.description, p.price, p.quantity, " + availableQuantitySQL + ", p.created_at"
+
+func productFields(p *models.Product) []any {
+	return []any{&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.Quantity, &p.Available, &p.CreatedAt}
 }
 
 func NewProductRepo(db *sql.DB, logger *zap.Logger) ProductRepo {
@@ -27,12 +46,36 @@ func NewProductRepo(db *sql.DB, logger *zap.Logger) ProductRepo {
 		Log: logger}
 }
 
-func (r *productRepo) GetAllProduct() ([]*models.Product, error) {
-	query := "SELECT id, name, description, price, quantity, created_at from products"
-	rows, err := r.db.Query(query)
+// ListProducts returns one keyset-paginated page of products matching the
+// filter, plus the total number of matches. The filter must already carry a
+// valid sort and limit.
+func (r *productRepo) ListProducts(filter *models.ProductFilter) (*models.ProductPage, error) {
+	f := productFilterSQL(filter)
+	page := &models.ProductPage{Items: []*models.Product{}}
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM products p"+f.clause(), f.args...).Scan(&page.Total); err != nil {
+		r.Log.Error("Failed to count products", zap.Error(err))
+		return nil, errors.New("failed to list products")
+	}
+
+	column, desc := productSort(filter.Sort)
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeProductCursor(filter.Cursor, filter.Sort)
+		if err != nil {
+			return nil, err
+		}
+		f.where(fmt.Sprintf("(%s, p.id) %s (%s, %s)", column, cmp, f.arg(cursor.Value), f.arg(cursor.ID)))
+	}
+	query := "SELECT " + productColumns + " FROM products p" +
+		f.clause() + fmt.Sprintf(" ORDER BY %s %s, p.id %s LIMIT %s", column, direction, direction, f.arg(filter.Limit+1))
+
+	rows, err := r.db.Query(query, f.args...)
 	if err != nil {
-		r.Log.Error("Failed to get all products", zap.Error(err))
-		return nil, errors.New("failed to get all products")
+		r.Log.Error("Failed to list products", zap.Error(err))
+		return nil, errors.New("failed to list products")
 	}
 	defer func(rows *sql.Rows) {
 		err := rows.Close()
@@ -41,27 +84,33 @@ func (r *productRepo) GetAllProduct() ([]*models.Product, error) {
 		}
 	}(rows)
 
-	var products []*models.Product
 	for rows.Next() {
 		product := &models.Product{}
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Quantity, &product.CreatedAt); err != nil {
-			r.Log.Error("Failed to get all products", zap.Error(err))
-			return nil, errors.New("failed to get all products")
+		if err := rows.Scan(productFields(product)...); err != nil {
+			r.Log.Error("Failed to list products", zap.Error(err))
+			return nil, errors.New("failed to list products")
 		}
-		products = append(products, product)
+		page.Items = append(page.Items, product)
 	}
 	if err := rows.Err(); err != nil {
-		r.Log.Error("Failed to get all products", zap.Error(err))
-		return nil, errors.New("failed to get all products")
+		r.Log.Error("Failed to list products", zap.Error(err))
+		return nil, errors.New("failed to list products")
 	}
-	return products, nil
+
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		page.NextCursor = encodeProductCursor(filter.Sort, page.Items[len(page.Items)-1])
+	}
+	return page, nil
 }
 
 func (r *productRepo) GetById(id int) (*models.Product, error) {
 	product := &models.Product{}
-	query := "SELECT id,  name, description, price, quantity, created_at FROM products WHERE id = $1"
-	err := r.db.QueryRow(query, id).Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Quantity, &product.CreatedAt)
-
+	query := "SELECT " + productColumns + " FROM products p WHERE p.id = $1 AND p.archived_at IS NULL"
+	err := r.db.QueryRow(query, id).Scan(productFields(product)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrProductNotFound
+	}
 	if err != nil {
 		r.Log.Error("Failed to get product by ID", zap.Error(err))
 		return nil, errors.New("failed to get product by id")
@@ -71,46 +120,377 @@ func (r *productRepo) GetById(id int) (*models.Product, error) {
 	return product, nil
 }
 
-func (r *productRepo) Create(product *models.Product) error {
-	err := r.db.QueryRow(
-		`INSERT INTO products (name, description, price, quantity)
-   VALUES ($1,$2,$3,$4) RETURNING id, created_at`,
-		product.Name, product.Description, product.Price, product.Quantity,
-	).Scan(&product.ID, &product.CreatedAt)
+// StreamProducts calls fn for every product matching the filter, in the
+// filter's sort order, reading rows one at a time instead of collecting them.
+// Limit and cursor are ignored. An error from fn stops the stream and is
+// returned as is.
+func (r *productRepo) StreamProducts(ctx context.Context, filter *models.ProductFilter, fn func(*models.Product) error) error {
+	f := productFilterSQL(filter)
+	column, desc := productSort(filter.Sort)
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	query := "SELECT " + productColumns + " FROM products p" + f.clause() +
+		fmt.Sprintf(" ORDER BY %s %s, p.id %s", column, direction, direction)
 
+	rows, err := r.db.QueryContext(ctx, query, f.args...)
 	if err != nil {
-		r.Log.Error("Failed to insert product", zap.Error(err))
-		return fmt.Errorf("productRepo.Create: %w", err)
+		r.Log.Error("Failed to stream products", zap.Error(err))
+		return errors.New("failed to stream products")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	for rows.Next() {
+		product := &models.Product{}
+		if err := rows.Scan(productFields(product)...); err != nil {
+			r.Log.Error("Failed to stream products", zap.Error(err))
+			return errors.New("failed to stream products")
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to stream products", zap.Error(err))
+		return errors.New("failed to stream products")
 	}
 	return nil
 }
 
-func (r *productRepo) Update(p *models.Product) error {
+// GetByIds fetches several products in one query. Missing IDs are simply
+// absent from the result, which is in no particular order.
+func (r *productRepo) GetByIds(ids []int) ([]*models.Product, error) {
+	query := "SELECT " + productColumns + " FROM products p WHERE p.id = ANY($1) AND p.archived_at IS NULL"
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		r.Log.Error("Failed to get products by IDs", zap.Error(err))
+		return nil, errors.New("failed to get products")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	products := []*models.Product{}
+	for rows.Next() {
+		product := &models.Product{}
+		if err := rows.Scan(productFields(product)...); err != nil {
+			r.Log.Error("Failed to get products by IDs", zap.Error(err))
+			return nil, errors.New("failed to get products")
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get products by IDs", zap.Error(err))
+		return nil, errors.New("failed to get products")
+	}
+	return products, nil
+}
+
+// Create inserts the product and records its initial quantity as a restock
+// ledger entry in the same transaction.
+func (r *productRepo) Create(product *models.Product, actorID int) error {
+	return inTx(r.db, r.Log, "productRepo.Create", func(tx *sql.Tx) error {
+		return r.insert(tx, product, actorID)
+	})
+}
+
+// Update overwrites the product fields. A changed quantity is recorded as an
+// adjustment ledger entry for the difference, so the ledger stays complete.
+// An empty SKU keeps the stored one.
+func (r *productRepo) Update(p *models.Product, actorID int) error {
+	return inTx(r.db, r.Log, "productRepo.Update", func(tx *sql.Tx) error {
+		return r.update(tx, p, actorID)
+	})
+}
+
+// UpsertResult is the outcome of upserting one product by SKU.
+type UpsertResult struct {
+	Created bool
+	Err     error
+}
+
+// UpsertBySKU creates or updates each product by its SKU, with the same ledger
+// entries as Create and Update. In atomic mode all products share one
+// transaction that is rolled back at the first failure; the results then stop
+// at the failing product and the error is returned as well. Otherwise every
+// product is saved in its own transaction and failures are only reported in
+// the results.
+func (r *productRepo) UpsertBySKU(products []*models.Product, actorID int, atomic bool) ([]UpsertResult, error) {
+	results := make([]UpsertResult, 0, len(products))
+	if atomic {
+		err := inTx(r.db, r.Log, "productRepo.UpsertBySKU", func(tx *sql.Tx) error {
+			for _, product := range products {
+				created, err := r.upsert(tx, product, actorID)
+				results = append(results, UpsertResult{Created: created, Err: err})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return results, err
+	}
+
+	for _, product := range products {
+		var created bool
+		err := inTx(r.db, r.Log, "productRepo.UpsertBySKU", func(tx *sql.Tx) error {
+			var err error
+			created, err = r.upsert(tx, product, actorID)
+			return err
+		})
+		results = append(results, UpsertResult{Created: created, Err: err})
+	}
+	return results, nil
+}
+
+// upsert updates the product with the same SKU, restoring it if it was
+// archived, or inserts a new one.
+func (r *productRepo) upsert(tx *sql.Tx, product *models.Product, actorID int) (bool, error) {
+	var archived bool
+	err := tx.QueryRow("SELECT id, archived_at IS NOT NULL FROM products WHERE sku = $1 FOR UPDATE", product.SKU).
+		Scan(&product.ID, &archived)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, r.insert(tx, product, actorID)
+	}
+	if err != nil {
+		r.Log.Error("Failed to look up product by SKU", zap.String("sku", product.SKU), zap.Error(err))
+		return false, err
+	}
+	if archived {
+		if _, err := tx.Exec("UPDATE products SET archived_at = NULL WHERE id = $1", product.ID); err != nil {
+			r.Log.Error("Failed to restore archived product", zap.Int("id", product.ID), zap.Error(err))
+			return false, err
+		}
+	}
+	return false, r.update(tx, product, actorID)
+}
+
+func (r *productRepo) insert(tx *sql.Tx, product *models.Product, actorID int) error {
+	err := tx.QueryRow(
+		`INSERT INTO products (sku, name, description, price, quantity)
+   VALUES (NULLIF($1, ''),$2,$3,$4,$5) RETURNING id, created_at`,
+		product.SKU, product.Name, product.Description, product.Price, product.Quantity,
+	).Scan(&product.ID, &product.CreatedAt)
+	if isPQError(err, pqUniqueViolation) {
+		return models.ErrProductSKUTaken
+	}
+	if err != nil {
+		r.Log.Error("Failed to insert product", zap.Error(err))
+		return err
+	}
+	product.Available = product.Quantity
+
+	if product.Quantity == 0 {
+		return nil
+	}
+	return r.insertMovement(tx, &models.StockMovement{
+		ProductID: product.ID,
+		Delta:     product.Quantity,
+		Reason:    models.StockReasonRestock,
+		ActorID:   optionalID(actorID),
+	})
+}
+
+func (r *productRepo) update(tx *sql.Tx, p *models.Product, actorID int) error {
+	var current int
+	err := tx.QueryRow("SELECT quantity FROM products WHERE id = $1 AND archived_at IS NULL FOR UPDATE", p.ID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrProductNotFound
+	}
+	if err != nil {
+		r.Log.Error("productRepo.Update lock failed", zap.Error(err))
+		return err
+	}
+
 	query := `
-        UPDATE products
-        SET name=$1, description=$2, price=$3, quantity=$4
+        UPDATE products p
+        SET name=$1, description=$2, price=$3, quantity=$4, sku=COALESCE(NULLIF($6, ''), sku)
         WHERE id=$5
-        RETURNING created_at`
-	if err := r.db.QueryRow(query,
-		p.Name, p.Description, p.Price, p.Quantity, p.ID,
-	).Scan(&p.CreatedAt); err != nil {
+        RETURNING COALESCE(sku, ''), created_at, ` + availableQuantitySQL
+	err = tx.QueryRow(query,
+		p.Name, p.Description, p.Price, p.Quantity, p.ID, p.SKU,
+	).Scan(&p.SKU, &p.CreatedAt, &p.Available)
+	if isPQError(err, pqUniqueViolation) {
+		return models.ErrProductSKUTaken
+	}
+	if err != nil {
 		r.Log.Error("productRepo.Update QueryRow failed", zap.Error(err))
-		return fmt.Errorf("productRepo.Update: %w", err)
+		return err
 	}
-	return nil
+
+	if p.Quantity == current {
+		return nil
+	}
+	return r.insertMovement(tx, &models.StockMovement{
+		ProductID: p.ID,
+		Delta:     p.Quantity - current,
+		Reason:    models.StockReasonAdjustment,
+		ActorID:   optionalID(actorID),
+	})
 }
 
+// Delete archives the product: it disappears from the catalog, search, feeds
+// and carts and can no longer be ordered, while its orders and stock history
+// keep pointing at it. Importing its SKU again restores it.
 func (r *productRepo) Delete(id int) error {
-	query := "DELETE FROM products WHERE id = $1"
-	res, err := r.db.Exec(query, id)
+	return inTx(r.db, r.Log, "productRepo.Delete", func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE products SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL", id)
+		if err != nil {
+			r.Log.Error("Failed to archive product", zap.Int("id", id), zap.Error(err))
+			return fmt.Errorf("failed to delete product %w", err)
+		}
+		rows, _ := res.RowsAffected()
+		if rows == 0 {
+			return models.ErrProductNotFound
+		}
+		if _, err := tx.Exec("DELETE FROM cart_items WHERE product_id = $1", id); err != nil {
+			r.Log.Error("Failed to remove archived product from carts", zap.Int("id", id), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// AdjustStock applies movement.Delta (negative to take stock) to the product
+// quantity, or to the variant quantity when movement.VariantID is set, without
+// touching any other column and appends the movement to the inventory ledger.
+// It never lets the quantity drop below zero and reports ErrInsufficientStock
+// instead. Pass a *sql.Tx as q to make the adjustment part of a larger
+// transaction, or nil to run it in its own transaction.
+func (r *productRepo) AdjustStock(q DBTX, movement *models.StockMovement) error {
+	if q == nil {
+		return inTx(r.db, r.Log, "productRepo.AdjustStock", func(tx *sql.Tx) error {
+			return r.AdjustStock(tx, movement)
+		})
+	}
+	if movement.VariantID != nil {
+		return r.adjustVariantStock(q, movement)
+	}
+	res, err := q.Exec(
+		"UPDATE products SET quantity = quantity + $1 WHERE id = $2 AND quantity + $1 >= 0",
+		movement.Delta, movement.ProductID,
+	)
 	if err != nil {
-		r.Log.Error("Failed to delete product", zap.Error(err))
-		return fmt.Errorf("failed to delete product %w", err)
+		r.Log.Error("Failed to adjust product stock", zap.Int("product_id", movement.ProductID), zap.Error(err))
+		return fmt.Errorf("productRepo.AdjustStock: %w", err)
 	}
 	rows, _ := res.RowsAffected()
-	if rows == 0 {
-		r.Log.Error("Failed to delete product, no rows affected", zap.Error(err))
-		return errors.New("failed to delete product")
+	if rows > 0 {
+		return r.insertMovement(q, movement)
+	}
+
+	var exists bool
+	if err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)", movement.ProductID).Scan(&exists); err != nil {
+		r.Log.Error("Failed to check product existence", zap.Int("product_id", movement.ProductID), zap.Error(err))
+		return fmt.Errorf("productRepo.AdjustStock: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("product %d: %w", movement.ProductID, models.ErrProductNotFound)
+	}
+	return fmt.Errorf("product %d: %w", movement.ProductID, models.ErrInsufficientStock)
+}
+
+func (r *productRepo) adjustVariantStock(q DBTX, movement *models.StockMovement) error {
+	variantID := *movement.VariantID
+	res, err := q.Exec(
+		"UPDATE product_variants SET quantity = quantity + $1 WHERE id = $2 AND product_id = $3 AND quantity + $1 >= 0",
+		movement.Delta, variantID, movement.ProductID,
+	)
+	if err != nil {
+		r.Log.Error("Failed to adjust variant stock", zap.Int("variant_id", variantID), zap.Error(err))
+		return fmt.Errorf("productRepo.AdjustStock: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows > 0 {
+		return r.insertMovement(q, movement)
+	}
+
+	var exists bool
+	err = q.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE id = $1 AND product_id = $2)",
+		variantID, movement.ProductID).Scan(&exists)
+	if err != nil {
+		r.Log.Error("Failed to check variant existence", zap.Int("variant_id", variantID), zap.Error(err))
+		return fmt.Errorf("productRepo.AdjustStock: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("variant %d: %w", variantID, models.ErrVariantNotFound)
+	}
+	return fmt.Errorf("variant %d: %w", variantID, models.ErrInsufficientStock)
+}
+
+func (r *productRepo) insertMovement(q DBTX, m *models.StockMovement) error {
+	err := q.QueryRow(
+		`INSERT INTO inventory_movements (product_id, variant_id, delta, reason, order_id, actor_id)
+   VALUES ($1,$2,$3,$4,$5,$6) RETURNING id, created_at`,
+		m.ProductID, m.VariantID, m.Delta, m.Reason, m.OrderID, m.ActorID,
+	).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		r.Log.Error("Failed to insert inventory movement", zap.Int("product_id", m.ProductID), zap.Error(err))
+		return fmt.Errorf("productRepo.insertMovement: %w", err)
 	}
 	return nil
 }
+
+func (r *productRepo) GetStockHistory(productID int) ([]*models.StockMovement, error) {
+	query := `SELECT id, product_id, variant_id, delta, reason, order_id, actor_id, created_at
+   FROM inventory_movements WHERE product_id = $1 ORDER BY created_at, id`
+	rows, err := r.db.Query(query, productID)
+	if err != nil {
+		r.Log.Error("Failed to get stock history", zap.Error(err))
+		return nil, errors.New("failed to get stock history")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	movements := []*models.StockMovement{}
+	for rows.Next() {
+		m := &models.StockMovement{}
+		var variantID, orderID, actorID sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.ProductID, &variantID, &m.Delta, &m.Reason, &orderID, &actorID, &m.CreatedAt); err != nil {
+			r.Log.Error("Failed to get stock history", zap.Error(err))
+			return nil, errors.New("failed to get stock history")
+		}
+		m.VariantID = nullableID(variantID)
+		m.OrderID = nullableID(orderID)
+		m.ActorID = nullableID(actorID)
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get stock history", zap.Error(err))
+		return nil, errors.New("failed to get stock history")
+	}
+	return movements, nil
+}
+
+// Reconcile recomputes the product quantity from its ledger, ignoring variant
+// movements, and compares it with the stored quantity. It only reports drift;
+// it never changes stock.
+func (r *productRepo) Reconcile(productID int) (*models.StockReconciliation, error) {
+	rec := &models.StockReconciliation{ProductID: productID}
+	query := `SELECT p.quantity, COALESCE((SELECT SUM(m.delta) FROM inventory_movements m WHERE m.product_id = p.id AND m.variant_id IS NULL), 0)
+   FROM products p WHERE p.id = $1`
+	err := r.db.QueryRow(query, productID).Scan(&rec.Quantity, &rec.LedgerQuantity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrProductNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to reconcile product stock", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to reconcile product stock")
+	}
+	rec.Drift = rec.Quantity - rec.LedgerQuantity
+	rec.InSync = rec.Drift == 0
+	return rec, nil
+}
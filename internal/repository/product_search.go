@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"go.uber.org/zap"
+	"html"
+	"mystore/internal/models"
+	"strings"
+)
+
+// similarityThreshold is the minimum trigram word similarity for the fuzzy
+// fallback to consider a product name a match.
+const similarityThreshold = 0.3
+
+// Matches come back from the database between these control characters, so
+// the text can be HTML-escaped before they become <mark> tags.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// searchText is the product text that snippets are cut from, with any marker
+// characters it happens to contain removed.
+const searchText = `translate(COALESCE(p.name, '') || ' ' || COALESCE(p.description, ''), chr(2) || chr(3), '')`
+
+// SearchProducts runs a full-text search over product names and descriptions,
+// best matches first.
+func (r *productRepo) SearchProducts(query string, limit int) ([]*models.ProductSearchResult, error) {
+	sqlQuery := `SELECT ` + productColumns + `,
+       ts_rank(p.search_vector, q) AS rank,
+       ts_headline('simple', ` + searchText + `, q, $3)
+   FROM products p, websearch_to_tsquery('simple', $1) q
+   WHERE p.search_vector @@ q AND p.archived_at IS NULL
+   ORDER BY rank DESC, p.id
+   LIMIT $2`
+	options := "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxWords=25, MinWords=8, MaxFragments=2"
+	return r.querySearch(sqlQuery, query, limit, options)
+}
+
+// SimilarProducts is the typo-tolerant fallback: products whose name is
+// similar to the query by trigrams, most similar first. The whole name is
+// the matched part of the snippet.
+func (r *productRepo) SimilarProducts(query string, limit int) ([]*models.ProductSearchResult, error) {
+	sqlQuery := `SELECT ` + productColumns + `,
+       word_similarity($1, p.name) AS rank,
+       chr(2) || translate(p.name, chr(2) || chr(3), '') || chr(3)
+   FROM products p
+   WHERE word_similarity($1, p.name) >= $3 AND p.archived_at IS NULL
+   ORDER BY rank DESC, p.id
+   LIMIT $2`
+	return r.querySearch(sqlQuery, query, limit, similarityThreshold)
+}
+
+// markSnippet HTML-escapes a snippet and turns its match markers into <mark>
+// tags, so product text can never inject markup.
+func markSnippet(snippet string) string {
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+func (r *productRepo) querySearch(sqlQuery string, args ...any) ([]*models.ProductSearchResult, error) {
+	rows, err := r.db.Query(sqlQuery, args...)
+	if err != nil {
+		r.Log.Error("Failed to search products", zap.Error(err))
+		return nil, errors.New("failed to search products")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	results := []*models.ProductSearchResult{}
+	for rows.Next() {
+		product := &models.Product{}
+		result := &models.ProductSearchResult{Product: product}
+		if err := rows.Scan(append(productFields(product), &result.Rank, &result.Snippet)...); err != nil {
+			r.Log.Error("Failed to search products", zap.Error(err))
+			return nil, errors.New("failed to search products")
+		}
+		result.Snippet = markSnippet(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to search products", zap.Error(err))
+		return nil, errors.New("failed to search products")
+	}
+	return results, nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import "testing"
+
+func TestMarkSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain text", "red " + snippetStart + "shoes" + snippetStop + " for kids", "red <mark>shoes</mark> for kids"},
+		{"markup in product text", snippetStart + "<script>alert(1)</script>" + snippetStop, "<mark>&lt;script&gt;alert(1)&lt;/script&gt;</mark>"},
+		{"attribute injection", `"><img src=x onerror=alert(1)> ` + snippetStart + "mug" + snippetStop, "&#34;&gt;&lt;img src=x onerror=alert(1)&gt; <mark>mug</mark>"},
+		{"entities", "Tom & Jerry " + snippetStart + "mug" + snippetStop, "Tom &amp; Jerry <mark>mug</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markSnippet(tt.snippet); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
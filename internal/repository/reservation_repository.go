@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"time"
+)
+
+// availableQuantitySQL is a product's sellable stock: the on-hand quantity
+// minus every unexpired active reservation that is not for a variant. It
+// expects products aliased as p.
+const availableQuantitySQL = `GREATEST(p.quantity - COALESCE((
+       SELECT SUM(sr.quantity) FROM stock_reservations sr
+       WHERE sr.product_id = p.id AND sr.variant_id IS NULL AND sr.status = 'active' AND sr.expires_at > NOW()), 0), 0)`
+
+// availableVariantQuantitySQL is the variant counterpart of
+// availableQuantitySQL. It expects product_variants aliased as v.
+const availableVariantQuantitySQL = `GREATEST(v.quantity - COALESCE((
+       SELECT SUM(sr.quantity) FROM stock_reservations sr
+       WHERE sr.variant_id = v.id AND sr.status = 'active' AND sr.expires_at > NOW()), 0), 0)`
+
+// ReservationRepository manages time-limited stock holds placed by pending
+// orders. Holds do not touch products.quantity until they are committed, but
+// they are subtracted from the available quantity while they are active.
+type ReservationRepository interface {
+	Reserve(q DBTX, orderID, productID, variantID, quantity int) error
+	Commit(q DBTX, orderID, actorID int) error
+	Release(q DBTX, orderID int) (int, error)
+	ExpiredOrderIDs(limit int) ([]int, error)
+}
+
+type reservationRepository struct {
+	db          *sql.DB
+	productRepo ProductRepo
+	ttl         time.Duration
+	Log         *zap.Logger
+}
+
+func NewReservationRepository(db *sql.DB, productRepo ProductRepo, ttl time.Duration, logger *zap.Logger) ReservationRepository {
+	return &reservationRepository{db: db,
+		productRepo: productRepo,
+		ttl:         ttl,
+		Log:         logger}
+}
+
+// Reserve places a hold on quantity units of the product, or of its variant
+// when variantID is positive, for the order. The product or variant row is
+// locked with SELECT ... FOR UPDATE for the rest of the caller's transaction,
+// so concurrent reservations of the same stock are serialised and can never
+// hold more than the on-hand quantity.
+func (r *reservationRepository) Reserve(q DBTX, orderID, productID, variantID, quantity int) error {
+	if q == nil {
+		q = r.db
+	}
+
+	var (
+		onHand int
+		err    error
+	)
+	if variantID > 0 {
+		err = q.QueryRow("SELECT quantity FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE", variantID, productID).Scan(&onHand)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("variant %d of product %d: %w", variantID, productID, models.ErrVariantNotFound)
+		}
+	} else {
+		err = q.QueryRow("SELECT quantity FROM products WHERE id = $1 FOR UPDATE", productID).Scan(&onHand)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("product %d: %w", productID, models.ErrProductNotFound)
+		}
+	}
+	if err != nil {
+		r.Log.Error("Failed to lock stock for reservation", zap.Int("product_id", productID), zap.Int("variant_id", variantID), zap.Error(err))
+		return fmt.Errorf("reservationRepository.Reserve: %w", err)
+	}
+
+	var held int
+	err = q.QueryRow(
+		`SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations
+   WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2 AND status = 'active' AND expires_at > NOW()`,
+		productID, optionalID(variantID),
+	).Scan(&held)
+	if err != nil {
+		r.Log.Error("Failed to sum active reservations", zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("reservationRepository.Reserve: %w", err)
+	}
+	if onHand-held < quantity {
+		return fmt.Errorf("product %d: %w", productID, models.ErrInsufficientStock)
+	}
+
+	_, err = q.Exec(
+		`INSERT INTO stock_reservations (order_id, product_id, variant_id, quantity, expires_at)
+   VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))`,
+		orderID, productID, optionalID(variantID), quantity, r.ttl.Seconds(),
+	)
+	if err != nil {
+		r.Log.Error("Failed to insert reservation", zap.Int("order_id", orderID), zap.Int("product_id", productID), zap.Error(err))
+		return fmt.Errorf("reservationRepository.Reserve: %w", err)
+	}
+	return nil
+}
+
+// Commit turns the order's active holds into sale entries in the inventory
+// ledger, decrementing product stock. It fails with ErrReservationExpired if
+// any hold has expired or was already released.
+// Orders placed before reservations existed have no holds at all; their stock
+// was taken at creation, so committing them is a no-op.
+func (r *reservationRepository) Commit(q DBTX, orderID, actorID int) error {
+	if q == nil {
+		q = r.db
+	}
+
+	rows, err := q.Query(
+		`SELECT id, product_id, variant_id, quantity, status, expires_at > NOW()
+   FROM stock_reservations WHERE order_id = $1 ORDER BY product_id, variant_id FOR UPDATE`,
+		orderID,
+	)
+	if err != nil {
+		r.Log.Error("Failed to get order reservations", zap.Int("order_id", orderID), zap.Error(err))
+		return fmt.Errorf("reservationRepository.Commit: %w", err)
+	}
+	type hold struct {
+		id, productID, quantity int
+		variantID               *int
+	}
+	var holds []hold
+	total := 0
+	for rows.Next() {
+		var (
+			h         hold
+			variantID sql.NullInt64
+			status    string
+			valid     bool
+		)
+		if err := rows.Scan(&h.id, &h.productID, &variantID, &h.quantity, &status, &valid); err != nil {
+			_ = rows.Close()
+			r.Log.Error("Failed to get order reservations", zap.Int("order_id", orderID), zap.Error(err))
+			return fmt.Errorf("reservationRepository.Commit: %w", err)
+		}
+		total++
+		if status != "active" || !valid {
+			_ = rows.Close()
+			return fmt.Errorf("order %d: %w", orderID, models.ErrReservationExpired)
+		}
+		h.variantID = nullableID(variantID)
+		holds = append(holds, h)
+	}
+	if err := rows.Close(); err != nil {
+		r.Log.Error("Failed to close rows", zap.Error(err))
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get order reservations", zap.Int("order_id", orderID), zap.Error(err))
+		return fmt.Errorf("reservationRepository.Commit: %w", err)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	for _, h := range holds {
+		err := r.productRepo.AdjustStock(q, &models.StockMovement{
+			ProductID: h.productID,
+			VariantID: h.variantID,
+			Delta:     -h.quantity,
+			Reason:    models.StockReasonSale,
+			OrderID:   &orderID,
+			ActorID:   optionalID(actorID),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec("UPDATE stock_reservations SET status = 'committed' WHERE id = $1", h.id); err != nil {
+			r.Log.Error("Failed to commit reservation", zap.Int("id", h.id), zap.Error(err))
+			return fmt.Errorf("reservationRepository.Commit: %w", err)
+		}
+	}
+	return nil
+}
+
+// Release drops every active hold of the order, expired or not, and returns
+// how many holds were released.
+func (r *reservationRepository) Release(q DBTX, orderID int) (int, error) {
+	if q == nil {
+		q = r.db
+	}
+	res, err := q.Exec("UPDATE stock_reservations SET status = 'released' WHERE order_id = $1 AND status = 'active'", orderID)
+	if err != nil {
+		r.Log.Error("Failed to release reservations", zap.Int("order_id", orderID), zap.Error(err))
+		return 0, fmt.Errorf("reservationRepository.Release: %w", err)
+	}
+	released, _ := res.RowsAffected()
+	return int(released), nil
+}
+
+// ExpiredOrderIDs returns pending orders that still have active holds past
+// their expiry, oldest first.
+func (r *reservationRepository) ExpiredOrderIDs(limit int) ([]int, error) {
+	query := `SELECT sr.order_id FROM stock_reservations sr JOIN orders o ON o.id = sr.order_id
+   WHERE sr.status = 'active' AND sr.expires_at <= NOW() AND o.status = 'pending'
+   GROUP BY sr.order_id ORDER BY MIN(sr.expires_at) LIMIT $1`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		r.Log.Error("Failed to get expired reservations", zap.Error(err))
+		return nil, errors.New("failed to get expired reservations")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			r.Log.Error("Failed to get expired reservations", zap.Error(err))
+			return nil, errors.New("failed to get expired reservations")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get expired reservations", zap.Error(err))
+		return nil, errors.New("failed to get expired reservations")
+	}
+	return ids, nil
+}
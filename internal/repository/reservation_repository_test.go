@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to TEST_DATABASE_URL, a database with
+// internal/migrations/migrations.sql applied. Tests that need it are skipped
+// when it is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(20)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+// TestCreateOrderDoesNotOversell places many one-unit orders for the same
+// product at once and checks that exactly the on-hand quantity is reserved.
+func TestCreateOrderDoesNotOversell(t *testing.T) {
+	db := openTestDB(t)
+	logger := zap.NewNop()
+	productRepo := NewProductRepo(db, logger)
+	reservationRepo := NewReservationRepository(db, productRepo, time.Hour, logger)
+	orderRepo := NewOrderRepository(db, productRepo, reservationRepo, logger)
+
+	suffix := time.Now().UnixNano()
+	user := &models.User{
+		Name:     "oversell",
+		Email:    fmt.Sprintf("oversell-%d@example.com", suffix),
+		Password: "x",
+		Role:     models.RoleUser,
+	}
+	if err := NewUserRepository(db, logger).CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		stock  = 10
+		buyers = 50
+	)
+	product := &models.Product{
+		SKU:      fmt.Sprintf("OVERSELL-%d", suffix),
+		Name:     "Oversell test",
+		Price:    1,
+		Quantity: stock,
+	}
+	if err := productRepo.Create(product, int(user.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		placed  int
+		refused int
+		failed  []error
+	)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order := &models.Orders{UserId: int(user.ID)}
+			err := orderRepo.CreateOrder(order, []models.OrderItemRequest{{ProductID: product.ID, Quantity: 1}})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				placed++
+			case errors.Is(err, models.ErrInsufficientStock):
+				refused++
+			default:
+				failed = append(failed, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		t.Fatalf("unexpected errors: %v", failed)
+	}
+	if placed != stock || refused != buyers-stock {
+		t.Fatalf("placed %d and refused %d orders, want %d and %d", placed, refused, stock, buyers-stock)
+	}
+
+	var held int
+	err := db.QueryRow(
+		"SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE product_id = $1 AND status = 'active'",
+		product.ID,
+	).Scan(&held)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held != stock {
+		t.Fatalf("%d units reserved, want %d", held, stock)
+	}
+}
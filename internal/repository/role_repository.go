@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+type RoleRepository interface {
+	GetAll() ([]*models.Role, error)
+	GetByName(name string) (*models.Role, error)
+	GetPermissions() ([]*models.Permission, error)
+	PermissionsForRole(name string) ([]string, error)
+	Create(role *models.Role) error
+	Update(role *models.Role) error
+	Delete(name string) error
+}
+
+type roleRepository struct {
+	db  *sql.DB
+	Log *zap.Logger
+}
+
+func NewRoleRepository(db *sql.DB, logger *zap.Logger) RoleRepository {
+	return &roleRepository{db: db,
+		Log: logger}
+}
+
+// roleSelect reads roles with their permission names, sorted.
+const roleSelect = `SELECT r.id, r.name, r.description, r.created_at,
+       COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+   FROM roles r
+   LEFT JOIN role_permissions rp ON rp.role_id = r.id
+   LEFT JOIN permissions p ON p.id = rp.permission_id`
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	role := &models.Role{}
+	var permissions pq.StringArray
+	if err := row.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &permissions); err != nil {
+		return nil, err
+	}
+	role.Permissions = permissions
+	return role, nil
+}
+
+func (r *roleRepository) GetAll() ([]*models.Role, error) {
+	rows, err := r.db.Query(roleSelect + " GROUP BY r.id ORDER BY r.name")
+	if err != nil {
+		r.Log.Error("Failed to get roles", zap.Error(err))
+		return nil, errors.New("failed to get roles")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			r.Log.Error("Failed to get roles", zap.Error(err))
+			return nil, errors.New("failed to get roles")
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get roles", zap.Error(err))
+		return nil, errors.New("failed to get roles")
+	}
+	return roles, nil
+}
+
+func (r *roleRepository) GetByName(name string) (*models.Role, error) {
+	role, err := scanRole(r.db.QueryRow(roleSelect+" WHERE r.name = $1 GROUP BY r.id", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRoleNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to get role", zap.String("name", name), zap.Error(err))
+		return nil, fmt.Errorf("roleRepository.GetByName: %w", err)
+	}
+	return role, nil
+}
+
+func (r *roleRepository) GetPermissions() ([]*models.Permission, error) {
+	rows, err := r.db.Query("SELECT id, name, description FROM permissions ORDER BY name")
+	if err != nil {
+		r.Log.Error("Failed to get permissions", zap.Error(err))
+		return nil, errors.New("failed to get permissions")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	permissions := []*models.Permission{}
+	for rows.Next() {
+		permission := &models.Permission{}
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			r.Log.Error("Failed to get permissions", zap.Error(err))
+			return nil, errors.New("failed to get permissions")
+		}
+		permissions = append(permissions, permission)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get permissions", zap.Error(err))
+		return nil, errors.New("failed to get permissions")
+	}
+	return permissions, nil
+}
+
+// PermissionsForRole returns the permission names the role grants. An
+// unknown role grants nothing.
+func (r *roleRepository) PermissionsForRole(name string) ([]string, error) {
+	var permissions pq.StringArray
+	err := r.db.QueryRow(
+		`SELECT COALESCE(array_agg(p.name ORDER BY p.name), '{}')
+   FROM roles r
+   JOIN role_permissions rp ON rp.role_id = r.id
+   JOIN permissions p ON p.id = rp.permission_id
+   WHERE r.name = $1`, name,
+	).Scan(&permissions)
+	if err != nil {
+		r.Log.Error("Failed to get role permissions", zap.String("role", name), zap.Error(err))
+		return nil, fmt.Errorf("roleRepository.PermissionsForRole: %w", err)
+	}
+	return permissions, nil
+}
+
+func (r *roleRepository) Create(role *models.Role) error {
+	return inTx(r.db, r.Log, "roleRepository.Create", func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			"INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id, created_at",
+			role.Name, role.Description,
+		).Scan(&role.ID, &role.CreatedAt)
+		if isPQError(err, pqUniqueViolation) {
+			return models.ErrRoleNameTaken
+		}
+		if err != nil {
+			r.Log.Error("Failed to insert role", zap.String("name", role.Name), zap.Error(err))
+			return err
+		}
+		return r.grant(tx, role)
+	})
+}
+
+// Update replaces the role's description and permissions.
+func (r *roleRepository) Update(role *models.Role) error {
+	return inTx(r.db, r.Log, "roleRepository.Update", func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			"UPDATE roles SET description = $1 WHERE name = $2 RETURNING id, created_at",
+			role.Description, role.Name,
+		).Scan(&role.ID, &role.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrRoleNotFound
+		}
+		if err != nil {
+			r.Log.Error("Failed to update role", zap.String("name", role.Name), zap.Error(err))
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = $1", role.ID); err != nil {
+			r.Log.Error("Failed to clear role permissions", zap.String("name", role.Name), zap.Error(err))
+			return err
+		}
+		return r.grant(tx, role)
+	})
+}
+
+// grant links the role to its permissions, which must be distinct. Names
+// missing from the permissions table fail with ErrUnknownPermission.
+func (r *roleRepository) grant(tx *sql.Tx, role *models.Role) error {
+	res, err := tx.Exec(
+		`INSERT INTO role_permissions (role_id, permission_id)
+   SELECT $1, id FROM permissions WHERE name = ANY($2)`,
+		role.ID, pq.Array(role.Permissions),
+	)
+	if err != nil {
+		r.Log.Error("Failed to grant role permissions", zap.String("name", role.Name), zap.Error(err))
+		return err
+	}
+	granted, _ := res.RowsAffected()
+	if int(granted) != len(role.Permissions) {
+		return models.ErrUnknownPermission
+	}
+	return nil
+}
+
+// Delete removes a role. Roles still assigned to users are refused with
+// ErrRoleInUse.
+func (r *roleRepository) Delete(name string) error {
+	res, err := r.db.Exec("DELETE FROM roles WHERE name = $1", name)
+	if isPQError(err, pqForeignKeyViolation) {
+		return models.ErrRoleInUse
+	}
+	if err != nil {
+		r.Log.Error("Failed to delete role", zap.String("name", name), zap.Error(err))
+		return fmt.Errorf("roleRepository.Delete: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrRoleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"time"
+)
+
+type TokenRepository interface {
+	Create(token *models.RefreshToken) error
+	GetByHash(hash string) (*models.RefreshToken, error)
+	Rotate(hash string, next *models.RefreshToken) error
+	RevokeFamily(familyID string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+}
+
+type tokenRepository struct {
+	db         *sql.DB
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	Log        *zap.Logger
+}
+
+// NewTokenRepository stores refresh tokens that expire refreshTTL after they
+// are issued, together with the expiry of the accessTTL access token issued
+// alongside. Expiry times are computed by the database, like reservations.
+func NewTokenRepository(db *sql.DB, accessTTL, refreshTTL time.Duration, logger *zap.Logger) TokenRepository {
+	return &tokenRepository{db: db,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		Log:        logger}
+}
+
+func (r *tokenRepository) Create(token *models.RefreshToken) error {
+	if err := r.insert(r.db, token); err != nil {
+		r.Log.Error("Failed to insert refresh token", zap.Int("user_id", token.UserID), zap.Error(err))
+		return fmt.Errorf("tokenRepository.Create: %w", err)
+	}
+	return nil
+}
+
+func (r *tokenRepository) GetByHash(hash string) (*models.RefreshToken, error) {
+	token, err := scanRefreshToken(r.db.QueryRow(refreshTokenSelect+" WHERE token_hash = $1", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		r.Log.Error("Failed to get refresh token", zap.Error(err))
+		return nil, fmt.Errorf("tokenRepository.GetByHash: %w", err)
+	}
+	return token, nil
+}
+
+// Rotate marks the token with the given hash as used and stores next in its
+// family. The token is locked first, so of two concurrent rotations only one
+// succeeds; the other gets ErrRefreshTokenReused.
+func (r *tokenRepository) Rotate(hash string, next *models.RefreshToken) error {
+	return inTx(r.db, r.Log, "tokenRepository.Rotate", func(tx *sql.Tx) error {
+		current, err := scanRefreshToken(tx.QueryRow(refreshTokenSelect+" WHERE token_hash = $1 FOR UPDATE", hash))
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrInvalidRefreshToken
+		}
+		if err != nil {
+			r.Log.Error("Failed to lock refresh token", zap.Error(err))
+			return err
+		}
+		switch {
+		case current.RevokedAt != nil || current.Expired:
+			return models.ErrInvalidRefreshToken
+		case current.UsedAt != nil:
+			return models.ErrRefreshTokenReused
+		}
+
+		if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", current.ID); err != nil {
+			r.Log.Error("Failed to mark refresh token used", zap.Int("id", current.ID), zap.Error(err))
+			return err
+		}
+		next.UserID, next.FamilyID = current.UserID, current.FamilyID
+		if err := r.insert(tx, next); err != nil {
+			r.Log.Error("Failed to insert refresh token", zap.Int("user_id", next.UserID), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// RevokeFamily revokes every refresh token in the family and puts the access
+// tokens issued with them that have not yet expired on the revocation list.
+func (r *tokenRepository) RevokeFamily(familyID string) error {
+	_, err := r.db.Exec(
+		`WITH revoked AS (
+       UPDATE refresh_tokens SET revoked_at = NOW()
+       WHERE family_id = $1 AND revoked_at IS NULL
+       RETURNING access_jti, access_expires_at
+   )
+   INSERT INTO revoked_tokens (jti, expires_at)
+   SELECT access_jti, access_expires_at FROM revoked WHERE access_expires_at > NOW()
+   ON CONFLICT (jti) DO NOTHING`,
+		familyID,
+	)
+	if err != nil {
+		r.Log.Error("Failed to revoke refresh token family", zap.String("family_id", familyID), zap.Error(err))
+		return fmt.Errorf("tokenRepository.RevokeFamily: %w", err)
+	}
+	return nil
+}
+
+// RevokeAccessToken puts a single access token on the revocation list and
+// drops entries whose tokens have expired anyway.
+func (r *tokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return inTx(r.db, r.Log, "tokenRepository.RevokeAccessToken", func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM revoked_tokens WHERE expires_at <= NOW()"); err != nil {
+			r.Log.Error("Failed to purge revoked tokens", zap.Error(err))
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, to_timestamp($2)) ON CONFLICT (jti) DO NOTHING",
+			jti, expiresAt.Unix(),
+		)
+		if err != nil {
+			r.Log.Error("Failed to revoke access token", zap.String("jti", jti), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+func (r *tokenRepository) IsRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > NOW())", jti,
+	).Scan(&revoked)
+	if err != nil {
+		r.Log.Error("Failed to check token revocation", zap.String("jti", jti), zap.Error(err))
+		return false, fmt.Errorf("tokenRepository.IsRevoked: %w", err)
+	}
+	return revoked, nil
+}
+
+const refreshTokenSelect = `SELECT id, user_id, family_id, token_hash, access_jti, access_expires_at,
+       expires_at, expires_at <= NOW(), used_at, revoked_at, created_at
+   FROM refresh_tokens`
+
+func scanRefreshToken(row rowScanner) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	var usedAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.AccessJTI,
+		&token.AccessExpiresAt, &token.ExpiresAt, &token.Expired, &usedAt, &revokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+func (r *tokenRepository) insert(q DBTX, token *models.RefreshToken) error {
+	return q.QueryRow(
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at)
+   VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW() + make_interval(secs => $6))
+   RETURNING id, access_expires_at, expires_at, created_at`,
+		token.UserID, token.FamilyID, token.TokenHash, token.AccessJTI, r.accessTTL.Seconds(), r.refreshTTL.Seconds(),
+	).Scan(&token.ID, &token.AccessExpiresAt, &token.ExpiresAt, &token.CreatedAt)
+}
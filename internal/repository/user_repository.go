@@ -31,6 +31,12 @@ func NewUserRepository(db *sql.DB, logger *zap.Logger) UserRepository {
 
 func (r *userRepository) CreateUser(user *models.User) error {
 	err := r.db.QueryRow("INSERT INTO users (name, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id, created_at", user.Name, user.Email, user.Password, user.Role).Scan(&user.ID, &user.CreatedAt)
+	if isPQError(err, pqForeignKeyViolation) {
+		return models.ErrRoleNotFound
+	}
+	if isPQError(err, pqUniqueViolation) {
+		return models.ErrEmailTaken
+	}
 	if err != nil {
 		r.Log.Error("Failed to insert user", zap.Error(err))
 		return fmt.Errorf("failed to insert user: %w", err)
@@ -72,8 +78,10 @@ func (r *userRepository) GetUserById(id int) (*models.User, error) {
 	user := &models.User{}
 	query := "SELECT id, name, email, password, role, created_at FROM users WHERE id = $1"
 	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrUserNotFound
+	}
 	if err != nil {
-
 		r.Log.Error("Failed to get user by ID", zap.Error(err))
 		return nil, errors.New("failed to get user")
 	}
@@ -106,6 +114,12 @@ func (r *userRepository) UpdateUser(user *models.User) error {
 	query := "UPDATE users SET name = $2, email = $3, password = $4, role = $5 WHERE id = $1"
 
 	res, err := r.db.Exec(query, user.ID, user.Name, user.Email, user.Password, user.Role)
+	if isPQError(err, pqForeignKeyViolation) {
+		return models.ErrRoleNotFound
+	}
+	if isPQError(err, pqUniqueViolation) {
+		return models.ErrEmailTaken
+	}
 	if err != nil {
 		r.Log.Error("Failed to update user", zap.Error(err))
 		return errors.New("error: userRepository.UpdateUser")
@@ -113,7 +127,7 @@ func (r *userRepository) UpdateUser(user *models.User) error {
 
 	rows, _ := res.RowsAffected()
 	if rows == 0 {
-		return errors.New("error: userRepository.UpdateUser no rows affected")
+		return models.ErrUserNotFound
 	}
 	return nil
 }
@@ -127,7 +141,7 @@ func (r *userRepository) DeleteUserById(id int) error {
 	}
 	rows, _ := res.RowsAffected()
 	if rows == 0 {
-		return errors.New("error: userRepository.DeleteUserById no rows affected")
+		return models.ErrUserNotFound
 	}
 
 	return nil
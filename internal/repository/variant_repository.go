@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+)
+
+// VariantRepository manages the variants of a product. Variant stock changes
+// go through ProductRepo.AdjustStock so they are recorded in the inventory
+// ledger like product stock.
+type VariantRepository interface {
+	GetByProduct(productID int) ([]*models.ProductVariant, error)
+	GetById(productID, id int) (*models.ProductVariant, error)
+	Create(variant *models.ProductVariant, actorID int) error
+	Update(variant *models.ProductVariant, actorID int) error
+	Delete(productID, id int) error
+}
+
+type variantRepository struct {
+	db          *sql.DB
+	productRepo ProductRepo
+	Log         *zap.Logger
+}
+
+func NewVariantRepository(db *sql.DB, productRepo ProductRepo, logger *zap.Logger) VariantRepository {
+	return &variantRepository{db: db,
+		productRepo: productRepo,
+		Log:         logger}
+}
+
+const variantColumns = "v.id, v.product_id, v.sku, v.options, v.price, v.quantity, " + availableVariantQuantitySQL + ", v.created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVariant(row rowScanner) (*models.ProductVariant, error) {
+	variant := &models.ProductVariant{}
+	var (
+		options []byte
+		price   sql.NullFloat64
+	)
+	err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &options, &price, &variant.Quantity, &variant.Available, &variant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(options, &variant.Options); err != nil {
+		return nil, err
+	}
+	if price.Valid {
+		variant.Price = &price.Float64
+	}
+	return variant, nil
+}
+
+func (r *variantRepository) GetByProduct(productID int) ([]*models.ProductVariant, error) {
+	rows, err := r.db.Query("SELECT "+variantColumns+" FROM product_variants v WHERE v.product_id = $1 ORDER BY v.id", productID)
+	if err != nil {
+		r.Log.Error("Failed to get product variants", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to get product variants")
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			r.Log.Error("Failed to close rows", zap.Error(err))
+		}
+	}(rows)
+
+	variants := []*models.ProductVariant{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			r.Log.Error("Failed to get product variants", zap.Int("product_id", productID), zap.Error(err))
+			return nil, errors.New("failed to get product variants")
+		}
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		r.Log.Error("Failed to get product variants", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to get product variants")
+	}
+	return variants, nil
+}
+
+func (r *variantRepository) GetById(productID, id int) (*models.ProductVariant, error) {
+	row := r.db.QueryRow("SELECT "+variantColumns+" FROM product_variants v WHERE v.id = $1 AND v.product_id = $2", id, productID)
+	variant, err := scanVariant(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrVariantNotFound
+	}
+	if err != nil {
+		r.Log.Error("Failed to get product variant", zap.Int("id", id), zap.Error(err))
+		return nil, errors.New("failed to get product variant")
+	}
+	return variant, nil
+}
+
+// Create inserts the variant with no stock and then restocks it to the
+// requested quantity, so the initial stock appears in the ledger.
+func (r *variantRepository) Create(variant *models.ProductVariant, actorID int) error {
+	options, err := json.Marshal(variant.Options)
+	if err != nil {
+		return fmt.Errorf("variantRepository.Create: %w", err)
+	}
+	return inTx(r.db, r.Log, "variantRepository.Create", func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`INSERT INTO product_variants (product_id, sku, options, price)
+   VALUES ($1,$2,$3,$4) RETURNING id, created_at`,
+			variant.ProductID, variant.SKU, options, variant.Price,
+		).Scan(&variant.ID, &variant.CreatedAt)
+		if err != nil {
+			return r.writeError(err)
+		}
+
+		quantity := variant.Quantity
+		variant.Quantity, variant.Available = 0, 0
+		if quantity == 0 {
+			return nil
+		}
+		err = r.productRepo.AdjustStock(tx, &models.StockMovement{
+			ProductID: variant.ProductID,
+			VariantID: &variant.ID,
+			Delta:     quantity,
+			Reason:    models.StockReasonRestock,
+			ActorID:   optionalID(actorID),
+		})
+		if err != nil {
+			return err
+		}
+		variant.Quantity, variant.Available = quantity, quantity
+		return nil
+	})
+}
+
+// Update overwrites the variant fields. A changed quantity is recorded as an
+// adjustment ledger entry for the difference.
+func (r *variantRepository) Update(variant *models.ProductVariant, actorID int) error {
+	options, err := json.Marshal(variant.Options)
+	if err != nil {
+		return fmt.Errorf("variantRepository.Update: %w", err)
+	}
+	return inTx(r.db, r.Log, "variantRepository.Update", func(tx *sql.Tx) error {
+		var current int
+		err := tx.QueryRow("SELECT quantity FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE",
+			variant.ID, variant.ProductID).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrVariantNotFound
+		}
+		if err != nil {
+			r.Log.Error("variantRepository.Update lock failed", zap.Error(err))
+			return err
+		}
+
+		err = tx.QueryRow(
+			"UPDATE product_variants SET sku = $1, options = $2, price = $3 WHERE id = $4 RETURNING created_at",
+			variant.SKU, options, variant.Price, variant.ID,
+		).Scan(&variant.CreatedAt)
+		if err != nil {
+			return r.writeError(err)
+		}
+
+		if variant.Quantity != current {
+			err := r.productRepo.AdjustStock(tx, &models.StockMovement{
+				ProductID: variant.ProductID,
+				VariantID: &variant.ID,
+				Delta:     variant.Quantity - current,
+				Reason:    models.StockReasonAdjustment,
+				ActorID:   optionalID(actorID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		query := "SELECT " + availableVariantQuantitySQL + " FROM product_variants v WHERE v.id = $1"
+		if err := tx.QueryRow(query, variant.ID).Scan(&variant.Available); err != nil {
+			r.Log.Error("Failed to get variant availability", zap.Int("id", variant.ID), zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// Delete removes the variant. Variants that were ever ordered are kept for the
+// order history and refused with ErrVariantInUse.
+func (r *variantRepository) Delete(productID, id int) error {
+	res, err := r.db.Exec("DELETE FROM product_variants WHERE id = $1 AND product_id = $2", id, productID)
+	if isPQError(err, pqForeignKeyViolation) {
+		return models.ErrVariantInUse
+	}
+	if err != nil {
+		r.Log.Error("Failed to delete product variant", zap.Int("id", id), zap.Error(err))
+		return fmt.Errorf("variantRepository.Delete: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return models.ErrVariantNotFound
+	}
+	return nil
+}
+
+func (r *variantRepository) writeError(err error) error {
+	switch {
+	case isPQError(err, pqUniqueViolation):
+		return models.ErrVariantSKUTaken
+	case isPQError(err, pqForeignKeyViolation):
+		return models.ErrProductNotFound
+	}
+	r.Log.Error("Failed to save product variant", zap.Error(err))
+	return err
+}
@@ -2,39 +2,142 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"mystore/internal/auth"
 	"mystore/internal/handlers"
 	"mystore/internal/middleware"
-	"os"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"mystore/internal/storage"
 )
 
-func SetupRoutes(userHandler *handlers.UserHandler, productHandler *handlers.ProductHandler) *gin.Engine {
+func SetupRoutes(userHandler *handlers.UserHandler, productHandler *handlers.ProductHandler, orderHandler *handlers.OrderHandler, cartHandler *handlers.CartHandler, webhookHandler *handlers.WebhookHandler, categoryHandler *handlers.CategoryHandler, feedHandler *handlers.FeedHandler, idempotencyRepo repository.IdempotencyRepository, tokenRepo repository.TokenRepository, jwtKeys *auth.KeyManager, keyHandler *handlers.KeyHandler, roleHandler *handlers.RoleHandler) *gin.Engine {
 	router := gin.Default()
-	jwtKey := []byte(os.Getenv("JWT_KEY"))
+	idempotent := middleware.Idempotency(idempotencyRepo)
+
+	router.GET("/.well-known/jwks.json", keyHandler.JWKS)
 
 	userGroup := router.Group("/user")
-	userGroup.GET("/", userHandler.GetAllUser)
-	userGroup.GET("/id/:id", userHandler.GetUserByID)
-	userGroup.GET("/email/:email", userHandler.GetUserByEmail)
-	userGroup.GET("/username/:username", userHandler.GetUserByUsername)
-	userGroup.PUT("/:id", userHandler.UpdateUser)
 	userGroup.POST("/login", userHandler.Login)
-	userGroup.POST("/", userHandler.CreateUser)
-	userGroup.DELETE("/:id", userHandler.DeleteUser)
+	userGroup.POST("/refresh", userHandler.Refresh)
+	userGroup.POST("/logout", middleware.OptionalAuthMiddleware(jwtKeys, tokenRepo), userHandler.Logout)
+	userGroup.POST("/", middleware.OptionalAuthMiddleware(jwtKeys, tokenRepo), idempotent, userHandler.CreateUser)
+
+	selfGroup := userGroup.Group("/me")
+	selfGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo))
+	{
+		selfGroup.GET("", userHandler.GetMe)
+		selfGroup.PUT("", userHandler.UpdateMe)
+		selfGroup.DELETE("", userHandler.DeleteMe)
+	}
+
+	manageUserGroup := userGroup.Group("")
+	manageUserGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo))
+	{
+		canRead := middleware.RequirePermission(models.PermUsersRead)
+		canWrite := middleware.RequirePermission(models.PermUsersWrite)
+		manageUserGroup.GET("/", canRead, userHandler.GetAllUser)
+		manageUserGroup.GET("/id/:id", canRead, userHandler.GetUserByID)
+		manageUserGroup.GET("/email/:email", canRead, userHandler.GetUserByEmail)
+		manageUserGroup.GET("/username/:username", canRead, userHandler.GetUserByUsername)
+		manageUserGroup.PUT("/:id", canWrite, userHandler.UpdateUser)
+		manageUserGroup.DELETE("/:id", canWrite, userHandler.DeleteUser)
+	}
 
 	protectedUser := router.Group("/protect/user")
-	protectedUser.Use(middleware.AuthMiddleware(jwtKey))
+	protectedUser.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo))
 	protectedUser.GET("/me", userHandler.GetMe)
 
 	productGroup := router.Group("/products")
+	productGroup.GET("/search", productHandler.Search)
+	productGroup.GET("/compare", productHandler.Compare)
 	productGroup.GET("/:id", productHandler.GetById)
-	productGroup.GET("/", productHandler.GetAllProduct)
+	productGroup.GET("/", productHandler.ListProducts)
 
 	adminGroup := router.Group("/admin/products")
-	adminGroup.Use(middleware.AuthMiddleware(jwtKey), middleware.AdminOnly())
+	adminGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo))
 	{
-		adminGroup.POST("/", productHandler.CreateProduct)
-		adminGroup.PUT("/:id", productHandler.UpdateProduct)
-		adminGroup.DELETE("/:id", productHandler.DeleteProduct)
+		canRead := middleware.RequirePermission(models.PermProductsRead)
+		canWrite := middleware.RequirePermission(models.PermProductsWrite)
+		adminGroup.POST("/", canWrite, idempotent, productHandler.CreateProduct)
+		adminGroup.POST("/import", canWrite, productHandler.ImportProducts)
+		adminGroup.GET("/export", canRead, productHandler.ExportProducts)
+		adminGroup.PUT("/:id", canWrite, productHandler.UpdateProduct)
+		adminGroup.DELETE("/:id", canWrite, productHandler.DeleteProduct)
+		adminGroup.GET("/:id/stock-history", canRead, productHandler.GetStockHistory)
+		adminGroup.GET("/:id/reconcile", canRead, productHandler.Reconcile)
+		adminGroup.GET("/:id/images", canRead, productHandler.GetImages)
+		adminGroup.POST("/:id/images", canWrite, productHandler.UploadImage)
+		adminGroup.PUT("/:id/images/order", canWrite, productHandler.ReorderImages)
+		adminGroup.PUT("/:id/images/:image_id/primary", canWrite, productHandler.SetPrimaryImage)
+		adminGroup.DELETE("/:id/images/:image_id", canWrite, productHandler.DeleteImage)
+		adminGroup.GET("/:id/variants", canRead, productHandler.GetVariants)
+		adminGroup.POST("/:id/variants", canWrite, productHandler.CreateVariant)
+		adminGroup.PUT("/:id/variants/:variant_id", canWrite, productHandler.UpdateVariant)
+		adminGroup.DELETE("/:id/variants/:variant_id", canWrite, productHandler.DeleteVariant)
 	}
+
+	router.GET("/feeds/products.xml", feedHandler.ProductFeed)
+
+	categoryGroup := router.Group("/categories")
+	categoryGroup.GET("/", categoryHandler.GetTree)
+	categoryGroup.GET("/:slug/products", categoryHandler.GetProductsBySlug)
+
+	adminCategoryGroup := router.Group("/admin/categories")
+	adminCategoryGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo), middleware.RequirePermission(models.PermCategoriesWrite))
+	{
+		adminCategoryGroup.GET("/", categoryHandler.GetAll)
+		adminCategoryGroup.GET("/:id", categoryHandler.GetById)
+		adminCategoryGroup.POST("/", categoryHandler.Create)
+		adminCategoryGroup.PUT("/:id", categoryHandler.Update)
+		adminCategoryGroup.DELETE("/:id", categoryHandler.Delete)
+		adminCategoryGroup.PUT("/:id/products/:product_id", categoryHandler.AddProduct)
+		adminCategoryGroup.DELETE("/:id/products/:product_id", categoryHandler.RemoveProduct)
+	}
+
+	orderGroup := router.Group("/orders")
+	orderGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo))
+	{
+		orderGroup.POST("/", idempotent, orderHandler.CreateOrder)
+		orderGroup.GET("/", orderHandler.GetOrders)
+		orderGroup.GET("/:id", orderHandler.GetOrderById)
+		orderGroup.POST("/:id/cancel", orderHandler.CancelOrder)
+		orderGroup.POST("/:id/pay", orderHandler.PayOrder)
+	}
+
+	cartGroup := router.Group("/cart")
+	cartGroup.Use(middleware.CartToken(), middleware.OptionalAuthMiddleware(jwtKeys, tokenRepo))
+	{
+		cartGroup.GET("/", cartHandler.GetCart)
+		cartGroup.DELETE("/", cartHandler.Clear)
+		cartGroup.POST("/items", cartHandler.AddItem)
+		cartGroup.PUT("/items/:product_id", cartHandler.UpdateItem)
+		cartGroup.DELETE("/items/:product_id", cartHandler.RemoveItem)
+		cartGroup.POST("/checkout", middleware.AuthMiddleware(jwtKeys, tokenRepo), cartHandler.Checkout)
+	}
+
+	adminOrderGroup := router.Group("/admin/orders")
+	adminOrderGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo), middleware.RequirePermission(models.PermOrdersRead))
+	{
+		adminOrderGroup.GET("/", orderHandler.GetAllOrders)
+		adminOrderGroup.GET("/:id", orderHandler.GetOrderForAdmin)
+		adminOrderGroup.GET("/:id/history", orderHandler.GetStatusHistory)
+		adminOrderGroup.GET("/:id/payments", orderHandler.GetPayments)
+		adminOrderGroup.PUT("/:id/status", middleware.RequirePermission(models.PermOrdersWrite), orderHandler.UpdateStatus)
+	}
+
+	adminRoleGroup := router.Group("/admin/roles")
+	adminRoleGroup.Use(middleware.AuthMiddleware(jwtKeys, tokenRepo), middleware.RequirePermission(models.PermRolesManage))
+	{
+		adminRoleGroup.GET("/", roleHandler.GetAll)
+		adminRoleGroup.GET("/:name", roleHandler.GetByName)
+		adminRoleGroup.POST("/", roleHandler.Create)
+		adminRoleGroup.PUT("/:name", roleHandler.Update)
+		adminRoleGroup.DELETE("/:name", roleHandler.Delete)
+	}
+	router.GET("/admin/permissions", middleware.AuthMiddleware(jwtKeys, tokenRepo),
+		middleware.RequirePermission(models.PermRolesManage), roleHandler.GetPermissions)
+
+	router.POST("/webhooks/payments", webhookHandler.PaymentWebhook)
+	router.GET(storage.LocalMediaPath+"/*key", productHandler.ServeMedia)
 	return router
 }
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+)
+
+type CartService interface {
+	GetCart(owner models.CartOwner) (*models.Cart, error)
+	AddItem(owner models.CartOwner, req *models.AddCartItemRequest) (*models.Cart, error)
+	UpdateItem(owner models.CartOwner, productID, quantity int) (*models.Cart, error)
+	RemoveItem(owner models.CartOwner, productID int) (*models.Cart, error)
+	Clear(owner models.CartOwner) error
+	Checkout(userID int) (*models.Orders, error)
+	MergeGuestCart(token string, userID int) error
+}
+
+type cartService struct {
+	repo         repository.CartRepository
+	productRepo  repository.ProductRepo
+	orderService OrderService
+	logger       *zap.Logger
+}
+
+func NewCartService(repo repository.CartRepository, productRepo repository.ProductRepo, orderService OrderService, logger *zap.Logger) CartService {
+	return &cartService{
+		repo:         repo,
+		productRepo:  productRepo,
+		orderService: orderService,
+		logger:       logger,
+	}
+}
+
+// GetCart returns the signed-in user's cart, or the guest cart bound to the
+// owner's cart token when nobody is signed in.
+func (s *cartService) GetCart(owner models.CartOwner) (*models.Cart, error) {
+	var (
+		cart *models.Cart
+		err  error
+	)
+	switch {
+	case owner.UserID > 0:
+		cart, err = s.repo.GetOrCreateByUser(owner.UserID)
+	case owner.Token != "":
+		cart, err = s.repo.GetOrCreateByToken(owner.Token)
+	default:
+		s.logger.Warn("cart owner is missing")
+		return nil, errors.New("cart owner is missing")
+	}
+	if err != nil {
+		s.logger.Error("error of getting cart", zap.Int("user_id", owner.UserID), zap.Error(err))
+		return nil, errors.New("failed to get cart")
+	}
+	return cart, nil
+}
+
+func (s *cartService) AddItem(owner models.CartOwner, req *models.AddCartItemRequest) (*models.Cart, error) {
+	if req.ProductID <= 0 || req.Quantity <= 0 {
+		s.logger.Warn("invalid cart item", zap.Any("item", req))
+		return nil, errors.New("invalid cart item")
+	}
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	quantity := req.Quantity
+	if item := findCartItem(cart, req.ProductID); item != nil {
+		quantity += item.Quantity
+	}
+	if err := s.checkStock(req.ProductID, quantity); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddItem(cart.ID, req.ProductID, req.Quantity); err != nil {
+		s.logger.Error("error of adding cart item", zap.Int("cart_id", cart.ID), zap.Error(err))
+		return nil, errors.New("failed to add cart item")
+	}
+	return s.GetCart(owner)
+}
+
+func (s *cartService) UpdateItem(owner models.CartOwner, productID, quantity int) (*models.Cart, error) {
+	if productID <= 0 || quantity <= 0 {
+		s.logger.Warn("invalid cart item", zap.Int("product_id", productID), zap.Int("quantity", quantity))
+		return nil, errors.New("invalid cart item")
+	}
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if findCartItem(cart, productID) == nil {
+		return nil, models.ErrCartItemNotFound
+	}
+	if err := s.checkStock(productID, quantity); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetItemQuantity(cart.ID, productID, quantity); err != nil {
+		if errors.Is(err, models.ErrCartItemNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of updating cart item", zap.Int("cart_id", cart.ID), zap.Error(err))
+		return nil, errors.New("failed to update cart item")
+	}
+	return s.GetCart(owner)
+}
+
+func (s *cartService) RemoveItem(owner models.CartOwner, productID int) (*models.Cart, error) {
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RemoveItem(cart.ID, productID); err != nil {
+		if errors.Is(err, models.ErrCartItemNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of removing cart item", zap.Int("cart_id", cart.ID), zap.Error(err))
+		return nil, errors.New("failed to remove cart item")
+	}
+	return s.GetCart(owner)
+}
+
+func (s *cartService) Clear(owner models.CartOwner) error {
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Clear(cart.ID); err != nil {
+		s.logger.Error("error of clearing cart", zap.Int("cart_id", cart.ID), zap.Error(err))
+		return errors.New("failed to clear cart")
+	}
+	return nil
+}
+
+// Checkout re-validates stock for every cart line, turns the cart into an order
+// and empties the cart. The order service reserves the stock under row locks
+// when it creates the order, so stock that ran out after validation still
+// fails the checkout.
+func (s *cartService) Checkout(userID int) (*models.Orders, error) {
+	if userID <= 0 {
+		s.logger.Warn("invalid user id", zap.Int("user_id", userID))
+		return nil, errors.New("invalid user id")
+	}
+	cart, err := s.GetCart(models.CartOwner{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, models.ErrCartEmpty
+	}
+
+	req := &models.CreateOrderRequest{Items: make([]models.OrderItemRequest, 0, len(cart.Items))}
+	for _, item := range cart.Items {
+		if item.Quantity > item.Available {
+			s.logger.Warn("cart item out of stock at checkout",
+				zap.Int("product_id", item.ProductID), zap.Int("quantity", item.Quantity), zap.Int("available", item.Available))
+			return nil, fmt.Errorf("product %d: %w", item.ProductID, models.ErrInsufficientStock)
+		}
+		req.Items = append(req.Items, models.OrderItemRequest{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	order, err := s.orderService.CreateOrder(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Clear(cart.ID); err != nil {
+		// The order is already placed; a stale cart is preferable to failing the checkout.
+		s.logger.Error("error of clearing cart after checkout", zap.Int("cart_id", cart.ID), zap.Int("order_id", order.ID), zap.Error(err))
+	}
+	return order, nil
+}
+
+// MergeGuestCart folds the guest cart bound to token into the user's cart,
+// capping merged quantities at the available stock.
+func (s *cartService) MergeGuestCart(token string, userID int) error {
+	if token == "" || userID <= 0 {
+		return nil
+	}
+	if err := s.repo.MergeGuestCart(token, userID); err != nil {
+		s.logger.Error("error of merging guest cart", zap.Int("user_id", userID), zap.Error(err))
+		return errors.New("failed to merge guest cart")
+	}
+	return nil
+}
+
+func (s *cartService) checkStock(productID, quantity int) error {
+	product, err := s.productRepo.GetById(productID)
+	if err != nil {
+		if errors.Is(err, models.ErrProductNotFound) {
+			return fmt.Errorf("product %d: %w", productID, err)
+		}
+		s.logger.Error("error of getting product", zap.Int("product_id", productID), zap.Error(err))
+		return errors.New("failed to get product")
+	}
+	if quantity > product.Available {
+		s.logger.Warn("not enough stock for cart item",
+			zap.Int("product_id", productID), zap.Int("quantity", quantity), zap.Int("available", product.Available))
+		return fmt.Errorf("product %d: %w", productID, models.ErrInsufficientStock)
+	}
+	return nil
+}
+
+func findCartItem(cart *models.Cart, productID int) *models.CartItem {
+	for i := range cart.Items {
+		if cart.Items[i].ProductID == productID {
+			return &cart.Items[i]
+		}
+	}
+	return nil
+}
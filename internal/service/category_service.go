@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"regexp"
+	"strings"
+)
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type CategoryService interface {
+	GetTree() ([]*models.Category, error)
+	GetAll() ([]*models.Category, error)
+	GetById(id int) (*models.Category, error)
+	Create(req *models.CategoryRequest) (*models.Category, error)
+	Update(id int, req *models.CategoryRequest) (*models.Category, error)
+	Delete(id int) error
+	AddProduct(categoryID, productID int) error
+	RemoveProduct(categoryID, productID int) error
+	GetProductsBySlug(slug string) ([]*models.Product, error)
+}
+
+type categoryService struct {
+	repo   repository.CategoryRepository
+	logger *zap.Logger
+}
+
+func NewCategoryService(repo repository.CategoryRepository, logger *zap.Logger) CategoryService {
+	return &categoryService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// GetTree returns the top-level categories with their subcategories nested
+// under Children.
+func (s *categoryService) GetTree() ([]*models.Category, error) {
+	categories, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	roots := []*models.Category{}
+	for _, category := range categories {
+		if parent, ok := byID[derefID(category.ParentID)]; ok {
+			parent.Children = append(parent.Children, category)
+			continue
+		}
+		roots = append(roots, category)
+	}
+	return roots, nil
+}
+
+func (s *categoryService) GetAll() ([]*models.Category, error) {
+	categories, err := s.repo.GetAll()
+	if err != nil {
+		s.logger.Error("error of getting categories", zap.Error(err))
+		return nil, fmt.Errorf("categoryService.GetAll: %w", err)
+	}
+	return categories, nil
+}
+
+func (s *categoryService) GetById(id int) (*models.Category, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid category id", zap.Int("id", id))
+		return nil, errors.New("invalid category id")
+	}
+	category, err := s.repo.GetById(id)
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of getting category", zap.Int("id", id), zap.Error(err))
+		return nil, errors.New("failed to get category")
+	}
+	return category, nil
+}
+
+func (s *categoryService) Create(req *models.CategoryRequest) (*models.Category, error) {
+	category, err := s.fromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(category); err != nil {
+		return nil, s.saveError("error of creating category", err)
+	}
+	return category, nil
+}
+
+// Update renames or moves a category. Moving it under itself or one of its own
+// descendants is refused with ErrCategoryCycle.
+func (s *categoryService) Update(id int, req *models.CategoryRequest) (*models.Category, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid category id", zap.Int("id", id))
+		return nil, errors.New("invalid category id")
+	}
+	category, err := s.fromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	category.ID = id
+
+	if category.ParentID != nil {
+		cycle, err := s.repo.IsDescendant(*category.ParentID, id)
+		if err != nil {
+			s.logger.Error("error of checking category tree", zap.Int("id", id), zap.Error(err))
+			return nil, errors.New("failed to update category")
+		}
+		if cycle {
+			s.logger.Warn("category cycle rejected", zap.Int("id", id), zap.Int("parent_id", *category.ParentID))
+			return nil, models.ErrCategoryCycle
+		}
+	}
+
+	if err := s.repo.Update(category); err != nil {
+		return nil, s.saveError("error of updating category", err)
+	}
+	return category, nil
+}
+
+func (s *categoryService) Delete(id int) error {
+	if id <= 0 {
+		s.logger.Warn("invalid category id", zap.Int("id", id))
+		return errors.New("invalid category id")
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return s.saveError("error of deleting category", err)
+	}
+	return nil
+}
+
+func (s *categoryService) AddProduct(categoryID, productID int) error {
+	if categoryID <= 0 || productID <= 0 {
+		s.logger.Warn("invalid category product link", zap.Int("category_id", categoryID), zap.Int("product_id", productID))
+		return errors.New("invalid category or product id")
+	}
+	if err := s.repo.AddProduct(categoryID, productID); err != nil {
+		return s.saveError("error of linking product to category", err)
+	}
+	return nil
+}
+
+func (s *categoryService) RemoveProduct(categoryID, productID int) error {
+	if categoryID <= 0 || productID <= 0 {
+		s.logger.Warn("invalid category product link", zap.Int("category_id", categoryID), zap.Int("product_id", productID))
+		return errors.New("invalid category or product id")
+	}
+	if err := s.repo.RemoveProduct(categoryID, productID); err != nil {
+		return s.saveError("error of unlinking product from category", err)
+	}
+	return nil
+}
+
+// GetProductsBySlug lists the products of the category and of all its
+// descendants.
+func (s *categoryService) GetProductsBySlug(slug string) ([]*models.Product, error) {
+	category, err := s.repo.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of getting category", zap.String("slug", slug), zap.Error(err))
+		return nil, errors.New("failed to get category")
+	}
+	products, err := s.repo.GetProductsInTree(category.ID)
+	if err != nil {
+		s.logger.Error("error of getting category products", zap.String("slug", slug), zap.Error(err))
+		return nil, fmt.Errorf("categoryService.GetProductsBySlug: %w", err)
+	}
+	return products, nil
+}
+
+func (s *categoryService) fromRequest(req *models.CategoryRequest) (*models.Category, error) {
+	name := strings.TrimSpace(req.Name)
+	slug := strings.TrimSpace(req.Slug)
+	if slug == "" && name != "" {
+		if slug = slugify(name); slug == "" {
+			return nil, models.ErrCategoryNeedsSlug
+		}
+	}
+	if name == "" || !slugPattern.MatchString(slug) {
+		s.logger.Warn("invalid category fields", zap.Any("category", req))
+		return nil, models.ErrInvalidCategory
+	}
+	if req.ParentID != nil && *req.ParentID <= 0 {
+		s.logger.Warn("invalid parent category id", zap.Int("parent_id", *req.ParentID))
+		return nil, errors.New("invalid parent category id")
+	}
+	return &models.Category{ParentID: req.ParentID, Name: name, Slug: slug}, nil
+}
+
+// saveError passes domain errors through and hides everything else.
+func (s *categoryService) saveError(msg string, err error) error {
+	for _, domainErr := range []error{models.ErrCategoryNotFound, models.ErrCategorySlugTaken,
+		models.ErrCategoryHasChildren, models.ErrProductNotFound} {
+		if errors.Is(err, domainErr) {
+			return err
+		}
+	}
+	s.logger.Error(msg, zap.Error(err))
+	return errors.New("failed to save category")
+}
+
+// slugify lower-cases name and joins its letters and digits with dashes. Only
+// ASCII letters and digits are kept, so a name without any gives "".
+func slugify(name string) string {
+	return strings.Trim(slugSeparator.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func derefID(id *int) int {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
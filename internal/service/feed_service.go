@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// feedBatchSize is how many products get their images loaded together
+	// while the feed is rendered.
+	feedBatchSize = 200
+	// feedMaxAdditionalImages is the most g:additional_image_link entries
+	// Google Merchant Center accepts per item.
+	feedMaxAdditionalImages = 10
+
+	googleBaseNamespace = "http://base.google.com/ns/1.0"
+)
+
+// FeedConfig describes the store in the product feed. BaseURL is prefixed to
+// product links and to image URLs that are not already absolute.
+type FeedConfig struct {
+	Title       string
+	Description string
+	BaseURL     string
+	Currency    string
+	TTL         time.Duration
+}
+
+// FeedService renders the catalog as an RSS 2.0 feed with Google Merchant
+// (g:) attributes. The rendered feed is cached for FeedConfig.TTL so crawlers
+// do not reach the database on every request.
+type FeedService interface {
+	ProductFeed(ctx context.Context) (*models.ProductFeed, error)
+}
+
+type feedService struct {
+	repo   repository.ProductRepo
+	images ImageService
+	config FeedConfig
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	cached *models.ProductFeed
+}
+
+func NewFeedService(repo repository.ProductRepo, images ImageService, config FeedConfig, logger *zap.Logger) FeedService {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &feedService{
+		repo:   repo,
+		images: images,
+		config: config,
+		logger: logger,
+	}
+}
+
+// ProductFeed returns the cached feed, rebuilding it once it has expired.
+// Concurrent callers wait for a single rebuild instead of each querying the
+// catalog. If a rebuild fails the previous feed is served until the next
+// attempt.
+func (s *feedService) ProductFeed(ctx context.Context) (*models.ProductFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.cached != nil && now.Before(s.cached.Expires) {
+		return s.cached, nil
+	}
+
+	// The rebuild is shared with every waiting caller, so it must not be
+	// cut short by the one request that happened to trigger it.
+	body, err := s.render(context.WithoutCancel(ctx))
+	if err != nil {
+		if s.cached != nil {
+			s.logger.Warn("error of rebuilding product feed, serving stale copy", zap.Error(err))
+			return s.cached, nil
+		}
+		s.logger.Error("error of building product feed", zap.Error(err))
+		return nil, fmt.Errorf("feedService.ProductFeed: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	feed := &models.ProductFeed{
+		Body:       body,
+		ETag:       `"` + hex.EncodeToString(sum[:16]) + `"`,
+		ModifiedAt: now.UTC().Truncate(time.Second),
+		Expires:    now.Add(s.config.TTL),
+	}
+	if s.cached != nil && s.cached.ETag == feed.ETag {
+		feed.ModifiedAt = s.cached.ModifiedAt
+	}
+	s.cached = feed
+	return feed, nil
+}
+
+type feedItem struct {
+	XMLName              xml.Name `xml:"item"`
+	ID                   string   `xml:"g:id"`
+	Title                string   `xml:"title"`
+	Description          string   `xml:"description"`
+	Link                 string   `xml:"link"`
+	Price                string   `xml:"g:price"`
+	Availability         string   `xml:"g:availability"`
+	Condition            string   `xml:"g:condition"`
+	ImageLink            string   `xml:"g:image_link,omitempty"`
+	AdditionalImageLinks []string `xml:"g:additional_image_link,omitempty"`
+}
+
+// render writes the whole feed. Products are streamed from the database and
+// their images loaded in batches, so only the output is held in memory.
+func (s *feedService) render(ctx context.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<rss version="2.0" xmlns:g="%s">`+"\n  <channel>\n", googleBaseNamespace)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("    ", "  ")
+	channel := []struct {
+		name, value string
+	}{
+		{"title", s.config.Title},
+		{"link", s.config.BaseURL + "/"},
+		{"description", s.config.Description},
+	}
+	for _, el := range channel {
+		if err := enc.EncodeElement(el.value, xml.StartElement{Name: xml.Name{Local: el.name}}); err != nil {
+			return nil, err
+		}
+	}
+
+	batch := make([]*models.Product, 0, feedBatchSize)
+	writeBatch := func() error {
+		if err := s.images.Attach(batch); err != nil {
+			return err
+		}
+		for _, product := range batch {
+			if err := enc.Encode(s.item(product)); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	filter := &models.ProductFilter{Sort: models.ProductSortName}
+	err := s.repo.StreamProducts(ctx, filter, func(product *models.Product) error {
+		batch = append(batch, product)
+		if len(batch) == feedBatchSize {
+			return writeBatch()
+		}
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = writeBatch()
+	}
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString("\n  </channel>\n</rss>\n")
+	return buf.Bytes(), nil
+}
+
+// item maps a product to a feed entry. Products without a SKU are identified
+// by their database ID; availability follows the stock not held by
+// reservations, as on the storefront.
+func (s *feedService) item(product *models.Product) feedItem {
+	item := feedItem{
+		ID:           product.SKU,
+		Title:        product.Name,
+		Description:  product.Description,
+		Link:         s.config.BaseURL + "/products/" + strconv.Itoa(product.ID),
+		Price:        strconv.FormatFloat(product.Price, 'f', 2, 64) + " " + s.config.Currency,
+		Availability: "in_stock",
+		Condition:    "new",
+	}
+	if item.ID == "" {
+		item.ID = strconv.Itoa(product.ID)
+	}
+	if item.Description == "" {
+		item.Description = product.Name
+	}
+	if product.Available <= 0 {
+		item.Availability = "out_of_stock"
+	}
+	for _, image := range product.Images {
+		link := s.absoluteURL(image.URL)
+		switch {
+		case image.IsPrimary && item.ImageLink == "":
+			item.ImageLink = link
+		case len(item.AdditionalImageLinks) < feedMaxAdditionalImages:
+			item.AdditionalImageLinks = append(item.AdditionalImageLinks, link)
+		}
+	}
+	return item
+}
+
+func (s *feedService) absoluteURL(u string) string {
+	if strings.HasPrefix(u, "/") {
+		return s.config.BaseURL + u
+	}
+	return u
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"mystore/internal/storage"
+	"net/http"
+)
+
+// MaxImageSize caps a single uploaded product image.
+const MaxImageSize = 5 << 20
+
+// imageExtensions lists the accepted image types, keyed by the sniffed
+// content type.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageService manages product images: the files go to the blob store, their
+// metadata, order and primary flag to the image repository.
+type ImageService interface {
+	Upload(ctx context.Context, productID int, r io.Reader, primary bool) (*models.ProductImage, error)
+	GetByProduct(productID int) ([]*models.ProductImage, error)
+	Attach(products []*models.Product) error
+	SetPrimary(productID, imageID int) error
+	Reorder(productID int, imageIDs []int) ([]*models.ProductImage, error)
+	Delete(ctx context.Context, productID, imageID int) error
+}
+
+type imageService struct {
+	repo   repository.ImageRepository
+	store  storage.BlobStore
+	logger *zap.Logger
+}
+
+func NewImageService(repo repository.ImageRepository, store storage.BlobStore, logger *zap.Logger) ImageService {
+	return &imageService{
+		repo:   repo,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Upload sniffs the image type from its content rather than trusting the
+// client, stores the file under a random key and records it for the product.
+// The stored file is removed again if the product turns out not to exist.
+func (s *imageService) Upload(ctx context.Context, productID int, r io.Reader, primary bool) (*models.ProductImage, error) {
+	if productID <= 0 {
+		s.logger.Warn("invalid product id", zap.Int("id", productID))
+		return nil, errors.New("invalid product id")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		s.logger.Warn("error of reading image upload", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to read image")
+	}
+	if len(data) > MaxImageSize {
+		return nil, models.ErrImageTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if len(data) == 0 || !ok {
+		s.logger.Warn("unsupported image upload", zap.Int("product_id", productID), zap.String("content_type", contentType))
+		return nil, models.ErrUnsupportedImage
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		s.logger.Error("error of generating image key", zap.Error(err))
+		return nil, errors.New("failed to store image")
+	}
+	key := fmt.Sprintf("products/%d/%s%s", productID, hex.EncodeToString(name), ext)
+	if err := s.store.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		s.logger.Error("error of storing image", zap.String("key", key), zap.Error(err))
+		return nil, errors.New("failed to store image")
+	}
+
+	image := &models.ProductImage{
+		ProductID:   productID,
+		StorageKey:  key,
+		ContentType: contentType,
+		Size:        len(data),
+		IsPrimary:   primary,
+	}
+	if err := s.repo.Create(image); err != nil {
+		if delErr := s.store.Delete(ctx, key); delErr != nil {
+			s.logger.Error("error of deleting orphaned image", zap.String("key", key), zap.Error(delErr))
+		}
+		if errors.Is(err, models.ErrProductNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of saving image", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to save image")
+	}
+	image.URL = s.store.URL(key)
+	return image, nil
+}
+
+func (s *imageService) GetByProduct(productID int) ([]*models.ProductImage, error) {
+	images, err := s.repo.GetByProduct(productID)
+	if err != nil {
+		s.logger.Error("error of getting product images", zap.Int("product_id", productID), zap.Error(err))
+		return nil, fmt.Errorf("imageService.GetByProduct: %w", err)
+	}
+	s.setURLs(images)
+	return images, nil
+}
+
+// Attach loads the images of all given products in one query and sets them on
+// each product.
+func (s *imageService) Attach(products []*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	byProduct, err := s.repo.GetByProducts(ids)
+	if err != nil {
+		s.logger.Error("error of getting product images", zap.Error(err))
+		return fmt.Errorf("imageService.Attach: %w", err)
+	}
+	for _, product := range products {
+		product.Images = byProduct[product.ID]
+		s.setURLs(product.Images)
+	}
+	return nil
+}
+
+func (s *imageService) SetPrimary(productID, imageID int) error {
+	if productID <= 0 || imageID <= 0 {
+		s.logger.Warn("invalid image id", zap.Int("product_id", productID), zap.Int("id", imageID))
+		return errors.New("invalid image id")
+	}
+	if err := s.repo.SetPrimary(productID, imageID); err != nil {
+		if errors.Is(err, models.ErrImageNotFound) {
+			return err
+		}
+		s.logger.Error("error of setting primary image", zap.Int("id", imageID), zap.Error(err))
+		return errors.New("failed to set primary image")
+	}
+	return nil
+}
+
+func (s *imageService) Reorder(productID int, imageIDs []int) ([]*models.ProductImage, error) {
+	if productID <= 0 || len(imageIDs) == 0 {
+		s.logger.Warn("invalid image order", zap.Int("product_id", productID), zap.Ints("image_ids", imageIDs))
+		return nil, models.ErrInvalidImageOrder
+	}
+	if err := s.repo.Reorder(productID, imageIDs); err != nil {
+		if errors.Is(err, models.ErrInvalidImageOrder) {
+			return nil, err
+		}
+		s.logger.Error("error of reordering images", zap.Int("product_id", productID), zap.Error(err))
+		return nil, errors.New("failed to reorder images")
+	}
+	return s.GetByProduct(productID)
+}
+
+// Delete removes the image record first and then its file; a file that cannot
+// be removed is only logged, since the image is already gone for clients.
+func (s *imageService) Delete(ctx context.Context, productID, imageID int) error {
+	if productID <= 0 || imageID <= 0 {
+		s.logger.Warn("invalid image id", zap.Int("product_id", productID), zap.Int("id", imageID))
+		return errors.New("invalid image id")
+	}
+	image, err := s.repo.Delete(productID, imageID)
+	if err != nil {
+		if errors.Is(err, models.ErrImageNotFound) {
+			return err
+		}
+		s.logger.Error("error of deleting image", zap.Int("id", imageID), zap.Error(err))
+		return errors.New("failed to delete image")
+	}
+	if err := s.store.Delete(ctx, image.StorageKey); err != nil {
+		s.logger.Error("error of deleting image file", zap.String("key", image.StorageKey), zap.Error(err))
+	}
+	return nil
+}
+
+func (s *imageService) setURLs(images []*models.ProductImage) {
+	for _, image := range images {
+		image.URL = s.store.URL(image.StorageKey)
+	}
+}
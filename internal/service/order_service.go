@@ -0,0 +1,503 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/payment"
+	"mystore/internal/repository"
+	"sort"
+	"time"
+)
+
+const (
+	// expiredReservationBatch caps how many expired orders one sweep cancels.
+	expiredReservationBatch = 100
+	paymentTimeout          = 10 * time.Second
+	paymentCurrency         = "USD"
+)
+
+type OrderService interface {
+	CreateOrder(userID int, req *models.CreateOrderRequest) (*models.Orders, error)
+	GetOrdersByUser(userID int) ([]*models.Orders, error)
+	GetOrderById(id, userID int) (*models.Orders, error)
+	GetAllOrders(status string) ([]*models.Orders, error)
+	GetOrderForAdmin(id int) (*models.Orders, error)
+	UpdateStatus(id int, status string, actorID int) (*models.Orders, error)
+	GetStatusHistory(id int) ([]*models.OrderStatusHistory, error)
+	CancelOrder(id, actorID int, isAdmin bool) (*models.Orders, error)
+	ReleaseExpiredReservations() (int, error)
+	RunReservationSweeper(ctx context.Context, interval time.Duration)
+	PayOrder(id, userID int) (*models.Orders, *models.Payment, error)
+	GetPayments(id int) ([]*models.Payment, error)
+	RefundPayment(pay *models.Payment) error
+}
+
+// orderTransitions lists, for every order status, the statuses it may move to.
+// Statuses without an entry (cancelled, refunded) are terminal.
+var orderTransitions = map[string][]string{
+	models.OrderStatusPending:   {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:      {models.OrderStatusShipped, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusShipped:   {models.OrderStatusDelivered},
+	models.OrderStatusDelivered: {models.OrderStatusRefunded},
+}
+
+func isKnownOrderStatus(status string) bool {
+	switch status {
+	case models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusShipped,
+		models.OrderStatusDelivered, models.OrderStatusCancelled, models.OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func canTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type orderService struct {
+	repo            repository.OrderRepository
+	reservationRepo repository.ReservationRepository
+	paymentRepo     repository.PaymentRepository
+	provider        payment.PaymentProvider
+	logger          *zap.Logger
+}
+
+func NewOrderService(repo repository.OrderRepository, reservationRepo repository.ReservationRepository,
+	paymentRepo repository.PaymentRepository, provider payment.PaymentProvider, logger *zap.Logger) OrderService {
+	return &orderService{
+		repo:            repo,
+		reservationRepo: reservationRepo,
+		paymentRepo:     paymentRepo,
+		provider:        provider,
+		logger:          logger,
+	}
+}
+
+func (s *orderService) CreateOrder(userID int, req *models.CreateOrderRequest) (*models.Orders, error) {
+	if userID <= 0 {
+		s.logger.Warn("invalid user id", zap.Int("user_id", userID))
+		return nil, errors.New("invalid user id")
+	}
+	if req == nil || len(req.Items) == 0 {
+		s.logger.Warn("order has no items", zap.Int("user_id", userID))
+		return nil, errors.New("order has no items")
+	}
+
+	items, err := mergeOrderItems(req.Items)
+	if err != nil {
+		s.logger.Warn("invalid order items", zap.Int("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	order := &models.Orders{UserId: userID}
+	if err := s.repo.CreateOrder(order, items); err != nil {
+		s.logger.Error("error of creating order", zap.Int("user_id", userID), zap.Error(err))
+		if errors.Is(err, models.ErrInsufficientStock) || errors.Is(err, models.ErrProductNotFound) ||
+			errors.Is(err, models.ErrVariantNotFound) {
+			return nil, err
+		}
+		return nil, errors.New("failed to create order")
+	}
+	return order, nil
+}
+
+// mergeOrderItems validates the requested items, collapses duplicate
+// product/variant pairs and sorts by product and variant ID so concurrent
+// orders lock rows in the same order.
+func mergeOrderItems(items []models.OrderItemRequest) ([]models.OrderItemRequest, error) {
+	type itemKey struct{ productID, variantID int }
+	quantities := make(map[itemKey]int, len(items))
+	for _, item := range items {
+		if item.ProductID <= 0 {
+			return nil, fmt.Errorf("invalid product id %d", item.ProductID)
+		}
+		if item.VariantID < 0 {
+			return nil, fmt.Errorf("invalid variant id %d", item.VariantID)
+		}
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("invalid quantity for product %d", item.ProductID)
+		}
+		quantities[itemKey{item.ProductID, item.VariantID}] += item.Quantity
+	}
+
+	merged := make([]models.OrderItemRequest, 0, len(quantities))
+	for key, quantity := range quantities {
+		merged = append(merged, models.OrderItemRequest{ProductID: key.productID, VariantID: key.variantID, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].ProductID != merged[j].ProductID {
+			return merged[i].ProductID < merged[j].ProductID
+		}
+		return merged[i].VariantID < merged[j].VariantID
+	})
+	return merged, nil
+}
+
+func (s *orderService) GetOrdersByUser(userID int) ([]*models.Orders, error) {
+	if userID <= 0 {
+		s.logger.Warn("invalid user id", zap.Int("user_id", userID))
+		return nil, errors.New("invalid user id")
+	}
+	orders, err := s.repo.GetOrdersByUser(userID)
+	if err != nil {
+		s.logger.Error("error of getting orders", zap.Int("user_id", userID), zap.Error(err))
+		return nil, fmt.Errorf("orderService.GetOrdersByUser: %w", err)
+	}
+	return orders, nil
+}
+
+// GetOrderById returns the order only if it belongs to userID; orders of other
+// users are reported as not found so their existence is not leaked.
+func (s *orderService) GetOrderById(id, userID int) (*models.Orders, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid order id", zap.Int("id", id))
+		return nil, errors.New("invalid order id")
+	}
+	order, err := s.repo.GetOrderById(id)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of getting order", zap.Int("id", id), zap.Error(err))
+		return nil, errors.New("failed to get order")
+	}
+	if order.UserId != userID {
+		s.logger.Warn("order does not belong to user", zap.Int("id", id), zap.Int("user_id", userID))
+		return nil, models.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (s *orderService) GetAllOrders(status string) ([]*models.Orders, error) {
+	if status != "" && !isKnownOrderStatus(status) {
+		s.logger.Warn("invalid order status filter", zap.String("status", status))
+		return nil, models.ErrInvalidOrderStatus
+	}
+	orders, err := s.repo.GetAllOrders(status)
+	if err != nil {
+		s.logger.Error("error of getting all orders", zap.Error(err))
+		return nil, fmt.Errorf("orderService.GetAllOrders: %w", err)
+	}
+	return orders, nil
+}
+
+func (s *orderService) GetOrderForAdmin(id int) (*models.Orders, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid order id", zap.Int("id", id))
+		return nil, errors.New("invalid order id")
+	}
+	order, err := s.repo.GetOrderById(id)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of getting order", zap.Int("id", id), zap.Error(err))
+		return nil, errors.New("failed to get order")
+	}
+	return order, nil
+}
+
+// UpdateStatus moves an order to the requested status if the lifecycle allows
+// it and returns the updated order. Disallowed moves yield ErrInvalidTransition,
+// and moving to paid without a captured payment yields ErrPaymentNotCaptured.
+func (s *orderService) UpdateStatus(id int, status string, actorID int) (*models.Orders, error) {
+	if !isKnownOrderStatus(status) {
+		s.logger.Warn("invalid order status", zap.String("status", status))
+		return nil, models.ErrInvalidOrderStatus
+	}
+	order, err := s.GetOrderForAdmin(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransitionOrder(order.Status, status) {
+		s.logger.Warn("rejected order status transition",
+			zap.Int("id", id), zap.String("from", order.Status), zap.String("to", status))
+		return nil, fmt.Errorf("%s -> %s: %w", order.Status, status, models.ErrInvalidTransition)
+	}
+	if status == models.OrderStatusPaid {
+		// An order is only paid once its money is taken; capture webhooks
+		// record the payment before they get here.
+		captured, err := s.paymentRepo.GetCapturedByOrder(id)
+		if err != nil {
+			s.logger.Error("error of getting captured payment", zap.Int("order_id", id), zap.Error(err))
+			return nil, errors.New("failed to get payment")
+		}
+		if captured == nil {
+			s.logger.Warn("rejected paid transition without captured payment", zap.Int("id", id))
+			return nil, models.ErrPaymentNotCaptured
+		}
+	}
+
+	if err := s.transition(order, status, actorID); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelOrder cancels an order that has not shipped yet and restocks its items.
+// Customers may only cancel their own orders; admins may cancel any order.
+func (s *orderService) CancelOrder(id, actorID int, isAdmin bool) (*models.Orders, error) {
+	var (
+		order *models.Orders
+		err   error
+	)
+	if isAdmin {
+		order, err = s.GetOrderForAdmin(id)
+	} else {
+		order, err = s.GetOrderById(id, actorID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canTransitionOrder(order.Status, models.OrderStatusCancelled) {
+		s.logger.Warn("rejected order cancellation", zap.Int("id", id), zap.String("status", order.Status))
+		return nil, fmt.Errorf("%s order cannot be cancelled: %w", order.Status, models.ErrInvalidTransition)
+	}
+
+	if err := s.transition(order, models.OrderStatusCancelled, actorID); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// transition persists an already validated status change. Payments commit
+// the order's stock reservations and cancellations give the stock back.
+// Refunds and cancellations of paid orders return the captured payment inside
+// the status change transaction: the order row is claimed first, so a
+// concurrent transition cannot slip in after the money went back, and the
+// change is rolled back if the refund fails.
+func (s *orderService) transition(order *models.Orders, to string, actorID int) error {
+	var refund func(repository.DBTX) error
+	if to == models.OrderStatusRefunded || (to == models.OrderStatusCancelled && order.Status == models.OrderStatusPaid) {
+		refund = func(q repository.DBTX) error {
+			return s.refundCapturedPayment(q, order.ID)
+		}
+	}
+
+	var err error
+	switch to {
+	case models.OrderStatusPaid:
+		err = s.repo.MarkPaid(order.ID, order.Status, actorID)
+	case models.OrderStatusCancelled:
+		err = s.repo.CancelOrder(order.ID, order.Status, actorID, refund)
+	default:
+		err = s.repo.UpdateStatus(order.ID, order.Status, to, actorID, refund)
+	}
+	if err != nil {
+		s.logger.Error("error of updating order status", zap.Int("id", order.ID), zap.String("to", to), zap.Error(err))
+		if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrReservationExpired) ||
+			errors.Is(err, models.ErrInsufficientStock) || errors.Is(err, models.ErrPaymentTimeout) ||
+			errors.Is(err, models.ErrPaymentFailed) {
+			return err
+		}
+		return errors.New("failed to update order status")
+	}
+	order.Status = to
+	return nil
+}
+
+func (s *orderService) GetStatusHistory(id int) ([]*models.OrderStatusHistory, error) {
+	if _, err := s.GetOrderForAdmin(id); err != nil {
+		return nil, err
+	}
+	history, err := s.repo.GetStatusHistory(id)
+	if err != nil {
+		s.logger.Error("error of getting order status history", zap.Int("id", id), zap.Error(err))
+		return nil, fmt.Errorf("orderService.GetStatusHistory: %w", err)
+	}
+	return history, nil
+}
+
+// ReleaseExpiredReservations cancels pending orders whose stock holds have
+// expired, which releases the holds. Orders that changed status in the
+// meantime are skipped. It returns the number of cancelled orders.
+func (s *orderService) ReleaseExpiredReservations() (int, error) {
+	ids, err := s.reservationRepo.ExpiredOrderIDs(expiredReservationBatch)
+	if err != nil {
+		s.logger.Error("error of getting expired reservations", zap.Error(err))
+		return 0, fmt.Errorf("orderService.ReleaseExpiredReservations: %w", err)
+	}
+
+	cancelled := 0
+	for _, id := range ids {
+		err := s.repo.CancelOrder(id, models.OrderStatusPending, 0, nil)
+		if errors.Is(err, models.ErrInvalidTransition) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("error of cancelling expired order", zap.Int("id", id), zap.Error(err))
+			continue
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// RunReservationSweeper calls ReleaseExpiredReservations every interval until
+// ctx is cancelled.
+func (s *orderService) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelled, err := s.ReleaseExpiredReservations()
+			if err != nil {
+				continue
+			}
+			if cancelled > 0 {
+				s.logger.Info("released expired stock reservations", zap.Int("orders", cancelled))
+			}
+		}
+	}
+}
+
+// PayOrder charges the order total through the payment provider and moves the
+// order from pending to paid only after the capture succeeded. Every attempt
+// is stored in payments, including declined and timed out ones.
+func (s *orderService) PayOrder(id, userID int) (*models.Orders, *models.Payment, error) {
+	order, err := s.GetOrderById(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.Status != models.OrderStatusPending {
+		s.logger.Warn("rejected payment of non-pending order", zap.Int("id", id), zap.String("status", order.Status))
+		return nil, nil, fmt.Errorf("%s order cannot be paid: %w", order.Status, models.ErrInvalidTransition)
+	}
+
+	pay := &models.Payment{
+		OrderID:  order.ID,
+		Provider: s.provider.Name(),
+		Amount:   order.Total,
+		Status:   models.PaymentStatusInitiated,
+	}
+	if err := s.paymentRepo.Create(pay); err != nil {
+		s.logger.Error("error of creating payment", zap.Int("order_id", order.ID), zap.Error(err))
+		return nil, nil, errors.New("failed to create payment")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	auth, err := s.provider.Authorize(ctx, payment.AuthorizeRequest{OrderID: order.ID, Amount: pay.Amount, Currency: paymentCurrency})
+	if auth != nil {
+		pay.ProviderRef = auth.Reference
+	}
+	if err != nil {
+		return nil, pay, s.failPayment(pay, err)
+	}
+	pay.Status = models.PaymentStatusAuthorized
+	s.savePayment(pay)
+
+	if _, err := s.provider.Capture(ctx, pay.ProviderRef, pay.Amount); err != nil {
+		return nil, pay, s.failPayment(pay, err)
+	}
+	pay.Status = models.PaymentStatusCaptured
+	s.savePayment(pay)
+
+	if err := s.transition(order, models.OrderStatusPaid, userID); err != nil {
+		// The money is taken but the order cannot be paid (e.g. its stock
+		// reservations expired), so hand it back straight away.
+		if refundErr := s.refundPayment(nil, pay); refundErr != nil {
+			s.logger.Error("error of refunding payment of unpaid order", zap.Int("order_id", order.ID), zap.Error(refundErr))
+		}
+		return nil, pay, err
+	}
+	return order, pay, nil
+}
+
+func (s *orderService) GetPayments(id int) ([]*models.Payment, error) {
+	if _, err := s.GetOrderForAdmin(id); err != nil {
+		return nil, err
+	}
+	payments, err := s.paymentRepo.GetByOrder(id)
+	if err != nil {
+		s.logger.Error("error of getting payments", zap.Int("order_id", id), zap.Error(err))
+		return nil, fmt.Errorf("orderService.GetPayments: %w", err)
+	}
+	return payments, nil
+}
+
+// failPayment records a provider error on the payment attempt and maps it to
+// the matching domain error.
+func (s *orderService) failPayment(pay *models.Payment, err error) error {
+	s.logger.Warn("payment attempt failed", zap.Int("order_id", pay.OrderID), zap.Int("payment_id", pay.ID), zap.Error(err))
+	pay.Error = err.Error()
+
+	var result error
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		pay.Status = models.PaymentStatusDeclined
+		result = models.ErrPaymentDeclined
+	case errors.Is(err, payment.ErrTimeout):
+		pay.Status = models.PaymentStatusFailed
+		result = models.ErrPaymentTimeout
+	default:
+		pay.Status = models.PaymentStatusFailed
+		result = models.ErrPaymentFailed
+	}
+	s.savePayment(pay)
+	return result
+}
+
+// savePayment persists the payment state. The provider call already happened,
+// so a failed write is logged rather than reported to the customer.
+func (s *orderService) savePayment(pay *models.Payment) {
+	if err := s.paymentRepo.Update(pay); err != nil {
+		s.logger.Error("error of updating payment", zap.Int("payment_id", pay.ID), zap.String("status", pay.Status), zap.Error(err))
+	}
+}
+
+// refundCapturedPayment refunds the order's captured payment, if it has one,
+// and records the refund through q.
+func (s *orderService) refundCapturedPayment(q repository.DBTX, orderID int) error {
+	pay, err := s.paymentRepo.GetCapturedByOrder(orderID)
+	if err != nil {
+		s.logger.Error("error of getting captured payment", zap.Int("order_id", orderID), zap.Error(err))
+		return errors.New("failed to get payment")
+	}
+	if pay == nil {
+		return nil
+	}
+	return s.refundPayment(q, pay)
+}
+
+// RefundPayment hands a captured payment back through the provider without
+// touching the order, for money taken on an order that cannot be paid.
+func (s *orderService) RefundPayment(pay *models.Payment) error {
+	return s.refundPayment(nil, pay)
+}
+
+// refundPayment refunds pay through the provider and records it through q,
+// or on its own when q is nil. A refund the provider made but that could not
+// be recorded is reported, so the caller does not treat it as done.
+func (s *orderService) refundPayment(q repository.DBTX, pay *models.Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	if _, err := s.provider.Refund(ctx, pay.ProviderRef, pay.Amount); err != nil {
+		s.logger.Error("error of refunding payment", zap.Int("payment_id", pay.ID), zap.Error(err))
+		if errors.Is(err, payment.ErrTimeout) {
+			return models.ErrPaymentTimeout
+		}
+		return models.ErrPaymentFailed
+	}
+	if err := s.paymentRepo.MarkRefunded(q, pay.ID); err != nil {
+		s.logger.Error("payment was refunded by the provider but not recorded",
+			zap.Int("payment_id", pay.ID), zap.String("ref", pay.ProviderRef), zap.Error(err))
+		return errors.New("failed to record refund")
+	}
+	pay.Status = models.PaymentStatusRefunded
+	pay.Error = ""
+	return nil
+}
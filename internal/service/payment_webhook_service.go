@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"math"
+	"mystore/internal/models"
+	"mystore/internal/payment"
+	"mystore/internal/repository"
+)
+
+// PaymentWebhookService applies asynchronous payment confirmations from the
+// gateway. It records payment state itself but leaves every order status
+// change to OrderService, so webhooks follow the same lifecycle rules as
+// admin transitions.
+type PaymentWebhookService interface {
+	HandleEvent(event *payment.WebhookEvent) error
+}
+
+type paymentWebhookService struct {
+	orderService OrderService
+	paymentRepo  repository.PaymentRepository
+	provider     string
+	logger       *zap.Logger
+}
+
+func NewPaymentWebhookService(orderService OrderService, paymentRepo repository.PaymentRepository, provider string, logger *zap.Logger) PaymentWebhookService {
+	return &paymentWebhookService{
+		orderService: orderService,
+		paymentRepo:  paymentRepo,
+		provider:     provider,
+		logger:       logger,
+	}
+}
+
+// HandleEvent applies the event exactly once. Events whose ID was already
+// processed are rejected with ErrWebhookReplay; events that fail to apply are
+// forgotten again so the gateway can retry them.
+func (s *paymentWebhookService) HandleEvent(event *payment.WebhookEvent) error {
+	if event.ID == "" || event.OrderID <= 0 || event.Reference == "" {
+		s.logger.Warn("invalid payment webhook event", zap.Any("event", event))
+		return errors.New("invalid webhook event")
+	}
+
+	recorded, err := s.paymentRepo.RecordWebhookEvent(event.ID, event.Type)
+	if err != nil {
+		s.logger.Error("error of recording webhook event", zap.String("event_id", event.ID), zap.Error(err))
+		return errors.New("failed to record webhook event")
+	}
+	if !recorded {
+		s.logger.Warn("replayed payment webhook event", zap.String("event_id", event.ID))
+		return models.ErrWebhookReplay
+	}
+
+	if err := s.apply(event); err != nil {
+		if forgetErr := s.paymentRepo.ForgetWebhookEvent(event.ID); forgetErr != nil {
+			s.logger.Error("error of forgetting failed webhook event", zap.String("event_id", event.ID), zap.Error(forgetErr))
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *paymentWebhookService) apply(event *payment.WebhookEvent) error {
+	order, err := s.orderService.GetOrderForAdmin(event.OrderID)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case payment.EventPaymentCaptured:
+		if math.Abs(event.Amount-order.Total) > 0.005 {
+			s.logger.Warn("webhook amount does not match order total",
+				zap.Int("order_id", order.ID), zap.Float64("amount", event.Amount), zap.Float64("total", order.Total))
+			return fmt.Errorf("amount %.2f for order total %.2f: %w", event.Amount, order.Total, models.ErrPaymentMismatch)
+		}
+		pay, err := s.recordPayment(order, event, models.PaymentStatusCaptured)
+		if err != nil {
+			return err
+		}
+		return s.applyCapture(order, pay)
+	case payment.EventPaymentFailed:
+		_, err := s.recordPayment(order, event, models.PaymentStatusFailed)
+		return err
+	case payment.EventPaymentDeclined:
+		_, err := s.recordPayment(order, event, models.PaymentStatusDeclined)
+		return err
+	case payment.EventPaymentRefunded:
+		// Mark the payment refunded first so the order transition does not
+		// ask the gateway to refund it a second time.
+		if _, err := s.recordPayment(order, event, models.PaymentStatusRefunded); err != nil {
+			return err
+		}
+		err := s.moveOrder(order, models.OrderStatusRefunded)
+		if errors.Is(err, models.ErrInvalidTransition) {
+			// Retrying the webhook would not make the transition valid.
+			s.logger.Warn("payment webhook cannot move order",
+				zap.Int("order_id", order.ID), zap.String("from", order.Status), zap.String("to", models.OrderStatusRefunded))
+			return nil
+		}
+		return err
+	default:
+		s.logger.Warn("unsupported payment webhook event", zap.String("type", event.Type))
+		return fmt.Errorf("unsupported webhook event type %q", event.Type)
+	}
+}
+
+// applyCapture marks the order paid. An order that can no longer be paid,
+// because it was cancelled or its stock holds expired, gets the captured money
+// back the way PayOrder does; the event is only acknowledged once the refund
+// went through.
+func (s *paymentWebhookService) applyCapture(order *models.Orders, pay *models.Payment) error {
+	if pay.Status != models.PaymentStatusCaptured {
+		// The money was already handed back, e.g. when the order was
+		// cancelled before this webhook arrived.
+		return nil
+	}
+	switch order.Status {
+	case models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusDelivered:
+		return nil
+	}
+	err := s.moveOrder(order, models.OrderStatusPaid)
+	if err == nil || !(errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrReservationExpired) ||
+		errors.Is(err, models.ErrInsufficientStock)) {
+		return err
+	}
+	s.logger.Warn("refunding captured payment of order that cannot be paid",
+		zap.Int("order_id", order.ID), zap.String("status", order.Status), zap.Error(err))
+	return s.orderService.RefundPayment(pay)
+}
+
+// recordPayment upserts the payment identified by the event reference and
+// returns it. Late events never move a payment backwards: the stored payment
+// is returned unchanged when it is already past status.
+func (s *paymentWebhookService) recordPayment(order *models.Orders, event *payment.WebhookEvent, status string) (*models.Payment, error) {
+	pay, err := s.paymentRepo.GetByProviderRef(s.provider, event.Reference)
+	if err != nil {
+		s.logger.Error("error of getting payment", zap.String("ref", event.Reference), zap.Error(err))
+		return nil, errors.New("failed to get payment")
+	}
+	if pay != nil && pay.OrderID != order.ID {
+		s.logger.Warn("webhook reference belongs to another order",
+			zap.String("ref", event.Reference), zap.Int("order_id", order.ID), zap.Int("payment_order_id", pay.OrderID))
+		return nil, fmt.Errorf("reference %s: %w", event.Reference, models.ErrPaymentMismatch)
+	}
+
+	if pay == nil {
+		pay = &models.Payment{
+			OrderID:     order.ID,
+			Provider:    s.provider,
+			ProviderRef: event.Reference,
+			Amount:      event.Amount,
+			Status:      status,
+			Error:       event.Reason,
+		}
+		if err := s.paymentRepo.Create(pay); err != nil {
+			s.logger.Error("error of creating payment from webhook", zap.Int("order_id", order.ID), zap.Error(err))
+			return nil, errors.New("failed to create payment")
+		}
+		return pay, nil
+	}
+
+	if !canRecordPaymentStatus(pay.Status, status) {
+		s.logger.Warn("ignoring out-of-order payment webhook",
+			zap.Int("payment_id", pay.ID), zap.String("status", pay.Status), zap.String("event_status", status))
+		return pay, nil
+	}
+	pay.Status = status
+	pay.Error = event.Reason
+	if err := s.paymentRepo.Update(pay); err != nil {
+		s.logger.Error("error of updating payment from webhook", zap.Int("payment_id", pay.ID), zap.Error(err))
+		return nil, errors.New("failed to update payment")
+	}
+	return pay, nil
+}
+
+// canRecordPaymentStatus reports whether a payment in status from may take
+// the status reported by a webhook. Refunded payments are final and captured
+// ones can only be refunded; earlier attempts may still turn out captured.
+func canRecordPaymentStatus(from, to string) bool {
+	switch from {
+	case models.PaymentStatusRefunded:
+		return to == models.PaymentStatusRefunded
+	case models.PaymentStatusCaptured:
+		return to == models.PaymentStatusCaptured || to == models.PaymentStatusRefunded
+	}
+	return true
+}
+
+// moveOrder asks the order service for the transition. Orders that already
+// reached the target status are left alone.
+func (s *paymentWebhookService) moveOrder(order *models.Orders, status string) error {
+	if order.Status == status {
+		return nil
+	}
+	_, err := s.orderService.UpdateStatus(order.ID, status, 0)
+	return err
+}
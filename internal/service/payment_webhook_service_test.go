@@ -0,0 +1,156 @@
+package service
+
+import (
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/payment"
+	"mystore/internal/repository"
+	"testing"
+)
+
+// fakeWebhookOrders serves a single order and counts refunds and status
+// changes. Refunds are saved to payments like the real service does.
+type fakeWebhookOrders struct {
+	OrderService
+	payments  *fakeWebhookPayments
+	order     models.Orders
+	updateErr error
+	updates   []string
+	refunds   int
+}
+
+func (f *fakeWebhookOrders) GetOrderForAdmin(int) (*models.Orders, error) {
+	order := f.order
+	return &order, nil
+}
+
+func (f *fakeWebhookOrders) UpdateStatus(_ int, status string, _ int) (*models.Orders, error) {
+	f.updates = append(f.updates, status)
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.order.Status = status
+	order := f.order
+	return &order, nil
+}
+
+func (f *fakeWebhookOrders) RefundPayment(pay *models.Payment) error {
+	f.refunds++
+	pay.Status = models.PaymentStatusRefunded
+	return f.payments.Update(pay)
+}
+
+// fakeWebhookPayments stores payments by provider reference.
+type fakeWebhookPayments struct {
+	repository.PaymentRepository
+	payments map[string]*models.Payment
+}
+
+func (f *fakeWebhookPayments) RecordWebhookEvent(string, string) (bool, error) { return true, nil }
+func (f *fakeWebhookPayments) ForgetWebhookEvent(string) error                 { return nil }
+
+func (f *fakeWebhookPayments) GetByProviderRef(_, ref string) (*models.Payment, error) {
+	pay, ok := f.payments[ref]
+	if !ok {
+		return nil, nil
+	}
+	stored := *pay
+	return &stored, nil
+}
+
+func (f *fakeWebhookPayments) Create(pay *models.Payment) error {
+	stored := *pay
+	f.payments[pay.ProviderRef] = &stored
+	return nil
+}
+
+func (f *fakeWebhookPayments) Update(pay *models.Payment) error {
+	stored := *pay
+	f.payments[pay.ProviderRef] = &stored
+	return nil
+}
+
+func TestCaptureWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		orderStatus string
+		payment     *models.Payment
+		updateErr   error
+		wantStatus  string
+		wantRefunds int
+		wantUpdates int
+	}{
+		{
+			name:        "pending order is paid",
+			orderStatus: models.OrderStatusPending,
+			wantStatus:  models.PaymentStatusCaptured,
+			wantUpdates: 1,
+		},
+		{
+			// PayOrder captured, the order was cancelled and refunded, and
+			// only then the gateway's capture webhook arrived.
+			name:        "late capture of refunded payment",
+			orderStatus: models.OrderStatusCancelled,
+			payment:     &models.Payment{Status: models.PaymentStatusRefunded},
+			wantStatus:  models.PaymentStatusRefunded,
+		},
+		{
+			name:        "capture for cancelled order is refunded",
+			orderStatus: models.OrderStatusCancelled,
+			updateErr:   models.ErrInvalidTransition,
+			wantStatus:  models.PaymentStatusRefunded,
+			wantRefunds: 1,
+			wantUpdates: 1,
+		},
+		{
+			name:        "capture after expired holds is refunded",
+			orderStatus: models.OrderStatusPending,
+			updateErr:   models.ErrReservationExpired,
+			wantStatus:  models.PaymentStatusRefunded,
+			wantRefunds: 1,
+			wantUpdates: 1,
+		},
+		{
+			name:        "capture of already paid order",
+			orderStatus: models.OrderStatusShipped,
+			payment:     &models.Payment{Status: models.PaymentStatusCaptured},
+			wantStatus:  models.PaymentStatusCaptured,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := &fakeWebhookPayments{payments: map[string]*models.Payment{}}
+			orders := &fakeWebhookOrders{
+				payments:  payments,
+				order:     models.Orders{ID: 7, Total: 25, Status: tt.orderStatus},
+				updateErr: tt.updateErr,
+			}
+			if tt.payment != nil {
+				stored := *tt.payment
+				stored.ID, stored.OrderID, stored.ProviderRef, stored.Amount = 1, 7, "pay_7", 25
+				payments.payments["pay_7"] = &stored
+			}
+			svc := NewPaymentWebhookService(orders, payments, "fake", zap.NewNop())
+
+			err := svc.HandleEvent(&payment.WebhookEvent{
+				ID:        "evt_7",
+				Type:      payment.EventPaymentCaptured,
+				OrderID:   7,
+				Reference: "pay_7",
+				Amount:    25,
+			})
+			if err != nil {
+				t.Fatalf("HandleEvent: %v", err)
+			}
+			if got := payments.payments["pay_7"].Status; got != tt.wantStatus {
+				t.Errorf("stored payment status %q, want %q", got, tt.wantStatus)
+			}
+			if orders.refunds != tt.wantRefunds {
+				t.Errorf("%d refunds, want %d", orders.refunds, tt.wantRefunds)
+			}
+			if len(orders.updates) != tt.wantUpdates {
+				t.Errorf("order status updates %v, want %d", orders.updates, tt.wantUpdates)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"mystore/internal/models"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery is how many products are written between flushes, so a
+// slow consumer sees steady progress without a flush per row.
+const exportFlushEvery = 100
+
+// exportCSVHeader names the CSV columns. The first five match what Import
+// reads, so an export can be edited and imported back.
+var exportCSVHeader = []string{"sku", "name", "description", "price", "quantity", "id", "available", "created_at"}
+
+// productEncoder writes one product in an export format. flush pushes any
+// buffered output to the writer and close finishes the document after the
+// last product.
+type productEncoder interface {
+	encode(product *models.Product) error
+	flush() error
+	close() error
+}
+
+// Export streams every product matching the list filters to w in the given
+// format, ignoring limit and cursor. Products are read from the database one
+// at a time, so memory use does not grow with the catalog. Nothing is written
+// if the format or filter is invalid.
+func (p *productService) Export(ctx context.Context, format string, filter *models.ProductFilter, w io.Writer) error {
+	if filter.Sort == "" {
+		filter.Sort = models.ProductSortName
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		p.logger.Warn("invalid price range", zap.Float64("min_price", *filter.MinPrice), zap.Float64("max_price", *filter.MaxPrice))
+		return fmt.Errorf("min_price must not exceed max_price: %w", models.ErrInvalidFilter)
+	}
+
+	var enc productEncoder
+	switch format {
+	case models.ExportFormatCSV:
+		enc = &csvProductEncoder{w: csv.NewWriter(w)}
+	case models.ExportFormatJSON:
+		enc = &jsonProductEncoder{w: w, array: true}
+	case models.ExportFormatNDJSON:
+		enc = &jsonProductEncoder{w: w}
+	default:
+		return fmt.Errorf("unknown export format %q: %w", format, models.ErrInvalidFilter)
+	}
+
+	flusher, _ := w.(interface{ Flush() })
+	count := 0
+	err := p.repo.StreamProducts(ctx, filter, func(product *models.Product) error {
+		if err := enc.encode(product); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := enc.flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.close()
+	}
+	if err != nil {
+		p.logger.Error("error of exporting products", zap.String("format", format), zap.Int("written", count), zap.Error(err))
+		return fmt.Errorf("productService.Export: %w", err)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+type csvProductEncoder struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvProductEncoder) encode(product *models.Product) error {
+	if !e.started {
+		e.started = true
+		if err := e.w.Write(exportCSVHeader); err != nil {
+			return err
+		}
+	}
+	return e.w.Write([]string{
+		product.SKU,
+		product.Name,
+		product.Description,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		strconv.Itoa(product.Quantity),
+		strconv.Itoa(product.ID),
+		strconv.Itoa(product.Available),
+		product.CreatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvProductEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// close writes the header for an empty export so the file still describes
+// its columns.
+func (e *csvProductEncoder) close() error {
+	if !e.started {
+		e.started = true
+		if err := e.w.Write(exportCSVHeader); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// jsonProductEncoder writes either a single JSON array or, without array,
+// one JSON object per line.
+type jsonProductEncoder struct {
+	w     io.Writer
+	array bool
+	count int
+}
+
+func (e *jsonProductEncoder) encode(product *models.Product) error {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if e.array {
+		prefix = ",\n"
+		if e.count == 0 {
+			prefix = "[\n"
+		}
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, prefix); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	if !e.array {
+		_, err = io.WriteString(e.w, "\n")
+	}
+	return err
+}
+
+func (e *jsonProductEncoder) flush() error {
+	return nil
+}
+
+func (e *jsonProductEncoder) close() error {
+	if !e.array {
+		return nil
+	}
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
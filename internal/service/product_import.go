@@ -0,0 +1,254 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"mystore/internal/models"
+	"strconv"
+	"strings"
+)
+
+// maxImportRows caps how many records one import request may carry.
+const maxImportRows = 5000
+
+// importRecord is one product parsed from an import file, or the reason it
+// could not be parsed.
+type importRecord struct {
+	product *models.Product
+	err     error
+}
+
+// Import upserts products by SKU from a CSV or JSON document. Every record is
+// validated like Create before anything is written. In atomic mode a single
+// invalid or failing record leaves the catalog untouched; in per-row mode the
+// valid records are saved independently of the failing ones.
+func (p *productService) Import(format, mode string, r io.Reader, actorID int) (*models.ImportReport, error) {
+	if mode == "" {
+		mode = models.ImportModeAtomic
+	}
+	if mode != models.ImportModeAtomic && mode != models.ImportModePerRow {
+		return nil, fmt.Errorf("unknown import mode %q: %w", mode, models.ErrInvalidImport)
+	}
+
+	var (
+		records []importRecord
+		err     error
+	)
+	switch format {
+	case models.ImportFormatCSV:
+		records, err = parseImportCSV(r)
+	case models.ImportFormatJSON:
+		records, err = parseImportJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q: %w", format, models.ErrInvalidImport)
+	}
+	if err != nil {
+		p.logger.Warn("unreadable product import", zap.String("format", format), zap.Error(err))
+		return nil, err
+	}
+	if len(records) == 0 || len(records) > maxImportRows {
+		return nil, fmt.Errorf("import must contain 1-%d records: %w", maxImportRows, models.ErrInvalidImport)
+	}
+
+	report := &models.ImportReport{Mode: mode, Rows: make([]models.ImportRowResult, len(records))}
+	var (
+		valid []*models.Product
+		rowOf []int
+	)
+	for i, record := range records {
+		row := &report.Rows[i]
+		row.Row = i + 1
+		if record.product != nil {
+			row.SKU = record.product.SKU
+		}
+		err := record.err
+		if err == nil {
+			err = validateImportProduct(record.product)
+		}
+		if err != nil {
+			row.Status, row.Error = models.ImportStatusFailed, err.Error()
+			continue
+		}
+		valid = append(valid, record.product)
+		rowOf = append(rowOf, i)
+	}
+
+	atomic := mode == models.ImportModeAtomic
+	if atomic && len(valid) < len(records) {
+		tallyImport(report)
+		return report, nil
+	}
+
+	results, err := p.repo.UpsertBySKU(valid, actorID, atomic)
+	if err != nil && !atomic {
+		p.logger.Error("error of importing products", zap.Error(err))
+		return nil, errors.New("failed to import products")
+	}
+	for i, result := range results {
+		row := &report.Rows[rowOf[i]]
+		switch {
+		case result.Err != nil:
+			row.Status, row.Error = models.ImportStatusFailed, importErrorMessage(result.Err)
+			if !errors.Is(result.Err, models.ErrProductSKUTaken) {
+				p.logger.Error("error of importing product", zap.String("sku", row.SKU), zap.Error(result.Err))
+			}
+		case result.Created:
+			row.Status, row.ProductID = models.ImportStatusCreated, valid[i].ID
+		default:
+			row.Status, row.ProductID = models.ImportStatusUpdated, valid[i].ID
+		}
+	}
+	if atomic && err != nil {
+		// The transaction was rolled back, so nothing before the failure stuck.
+		for i := range report.Rows {
+			if report.Rows[i].Status != models.ImportStatusFailed {
+				report.Rows[i].Status, report.Rows[i].ProductID = "", 0
+			}
+		}
+	}
+	tallyImport(report)
+	return report, nil
+}
+
+// tallyImport marks rows that were never written as skipped and fills in the
+// report totals.
+func tallyImport(report *models.ImportReport) {
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		switch row.Status {
+		case models.ImportStatusCreated:
+			report.Created++
+		case models.ImportStatusUpdated:
+			report.Updated++
+		case models.ImportStatusFailed:
+			report.Failed++
+		default:
+			row.Status = models.ImportStatusSkipped
+			report.Skipped++
+		}
+	}
+	report.Committed = report.Created+report.Updated > 0
+}
+
+func validateImportProduct(product *models.Product) error {
+	if product.SKU == "" {
+		return errors.New("invalid product fields: sku is required")
+	}
+	return validateProduct(product)
+}
+
+// importErrorMessage keeps database details out of the report.
+func importErrorMessage(err error) string {
+	if errors.Is(err, models.ErrProductSKUTaken) {
+		return models.ErrProductSKUTaken.Error()
+	}
+	return "failed to save product"
+}
+
+// parseImportCSV reads a CSV document whose header names the columns sku,
+// name, description, price and quantity, in any order. Every column is
+// required, since products cannot be saved without a description.
+func parseImportCSV(r io.Reader) ([]importRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing CSV header: %w: %w", models.ErrInvalidImport, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"sku", "name", "description", "price", "quantity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header has no %q column: %w", required, models.ErrInvalidImport)
+		}
+	}
+
+	var records []importRecord
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if len(records) >= maxImportRows {
+			return nil, fmt.Errorf("import must contain 1-%d records: %w", maxImportRows, models.ErrInvalidImport)
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("reading CSV: %w: %w", models.ErrInvalidImport, err)
+			}
+			records = append(records, importRecord{err: parseErr.Err})
+			continue
+		}
+		records = append(records, csvRecord(columns, fields))
+	}
+	return records, nil
+}
+
+func csvRecord(columns map[string]int, fields []string) importRecord {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+	product := &models.Product{
+		SKU:         field("sku"),
+		Name:        field("name"),
+		Description: field("description"),
+	}
+	price, err := strconv.ParseFloat(field("price"), 64)
+	if err != nil {
+		return importRecord{product: product, err: fmt.Errorf("invalid price %q", field("price"))}
+	}
+	quantity, err := strconv.Atoi(field("quantity"))
+	if err != nil {
+		return importRecord{product: product, err: fmt.Errorf("invalid quantity %q", field("quantity"))}
+	}
+	product.Price, product.Quantity = price, quantity
+	return importRecord{product: product}
+}
+
+// parseImportJSON reads a JSON array of product objects. A malformed object
+// only fails its own record.
+func parseImportJSON(r io.Reader) ([]importRecord, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of products: %w: %w", models.ErrInvalidImport, err)
+	}
+	if len(raw) > maxImportRows {
+		return nil, fmt.Errorf("import must contain 1-%d records: %w", maxImportRows, models.ErrInvalidImport)
+	}
+
+	records := make([]importRecord, 0, len(raw))
+	for _, item := range raw {
+		var fields struct {
+			SKU         string  `json:"sku"`
+			Name        string  `json:"name"`
+			Description string  `json:"description"`
+			Price       float64 `json:"price"`
+			Quantity    int     `json:"quantity"`
+		}
+		if err := json.Unmarshal(item, &fields); err != nil {
+			records = append(records, importRecord{err: fmt.Errorf("invalid product object: %v", err)})
+			continue
+		}
+		records = append(records, importRecord{product: &models.Product{
+			SKU:         strings.TrimSpace(fields.SKU),
+			Name:        strings.TrimSpace(fields.Name),
+			Description: strings.TrimSpace(fields.Description),
+			Price:       fields.Price,
+			Quantity:    fields.Quantity,
+		}})
+	}
+	return records, nil
+}
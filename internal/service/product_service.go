@@ -1,40 +1,122 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"io"
 	"mystore/internal/models"
 	"mystore/internal/repository"
+	"strings"
+	"time"
 )
 
+const maxSearchQueryLength = 200
+
 type ProductService interface {
-	GetAllProduct() ([]*models.Product, error)
+	ListProducts(filter *models.ProductFilter) (*models.ProductPage, error)
+	Search(req *models.ProductSearchRequest) (*models.ProductSearchPage, error)
+	Compare(ids []int) (*models.ProductComparison, error)
+	Import(format, mode string, r io.Reader, actorID int) (*models.ImportReport, error)
+	Export(ctx context.Context, format string, filter *models.ProductFilter, w io.Writer) error
 	GetById(id int) (*models.Product, error)
-	Create(product *models.Product) error
-	Update(product *models.Product) error
+	Create(product *models.Product, actorID int) error
+	Update(product *models.Product, actorID int) error
 	Delete(id int) error
+	GetStockHistory(id int) ([]*models.StockMovement, error)
+	Reconcile(id int) (*models.StockReconciliation, error)
+	GetVariants(productID int) ([]*models.ProductVariant, error)
+	CreateVariant(productID int, req *models.ProductVariantRequest, actorID int) (*models.ProductVariant, error)
+	UpdateVariant(productID, variantID int, req *models.ProductVariantRequest, actorID int) (*models.ProductVariant, error)
+	DeleteVariant(productID, variantID int) error
 }
 
 type productService struct {
-	repo   repository.ProductRepo
-	logger *zap.Logger
+	repo        repository.ProductRepo
+	variantRepo repository.VariantRepository
+	images      ImageService
+	logger      *zap.Logger
 }
 
-func NewProductService(repo repository.ProductRepo, logger *zap.Logger) ProductService {
+func NewProductService(repo repository.ProductRepo, variantRepo repository.VariantRepository, images ImageService, logger *zap.Logger) ProductService {
 	return &productService{
-		repo:   repo,
-		logger: logger,
+		repo:        repo,
+		variantRepo: variantRepo,
+		images:      images,
+		logger:      logger,
 	}
 }
 
-func (p *productService) GetAllProduct() ([]*models.Product, error) {
-	products, err := p.repo.GetAllProduct()
+// ListProducts fills in the default sort and page size and validates the
+// price range before querying. The page carries facet counts for the same
+// filter.
+func (p *productService) ListProducts(filter *models.ProductFilter) (*models.ProductPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = "-" + models.ProductSortCreatedAt
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = models.DefaultProductLimit
+	}
+	if filter.Limit > models.MaxProductLimit {
+		filter.Limit = models.MaxProductLimit
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		p.logger.Warn("invalid price range", zap.Float64("min_price", *filter.MinPrice), zap.Float64("max_price", *filter.MaxPrice))
+		return nil, fmt.Errorf("min_price must not exceed max_price: %w", models.ErrInvalidFilter)
+	}
+
+	page, err := p.repo.ListProducts(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			return nil, err
+		}
+		p.logger.Error("error of listing products", zap.Error(err))
+		return nil, fmt.Errorf("productService.ListProducts: %w", err)
+	}
+	if err := p.images.Attach(page.Items); err != nil {
+		return nil, fmt.Errorf("productService.ListProducts: %w", err)
+	}
+	page.Facets, err = p.repo.GetFacets(filter)
 	if err != nil {
-		p.logger.Error("error of getting all products")
-		return nil, fmt.Errorf("productService.GetAllProducts: %w", err)
+		p.logger.Error("error of counting product facets", zap.Error(err))
+		return nil, fmt.Errorf("productService.ListProducts: %w", err)
 	}
-	return products, nil
+	return page, nil
+}
+
+// Search ranks products by full-text relevance. When the full-text query
+// matches nothing, e.g. because of a typo, it falls back to trigram
+// similarity on product names.
+func (p *productService) Search(req *models.ProductSearchRequest) (*models.ProductSearchPage, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" || len(query) > maxSearchQueryLength {
+		p.logger.Warn("invalid search query", zap.Int("length", len(query)))
+		return nil, fmt.Errorf("search query must be 1-%d characters: %w", maxSearchQueryLength, models.ErrInvalidFilter)
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = models.DefaultProductLimit
+	}
+	if limit > models.MaxProductLimit {
+		limit = models.MaxProductLimit
+	}
+
+	results, err := p.repo.SearchProducts(query, limit)
+	if err != nil {
+		p.logger.Error("error of searching products", zap.String("q", query), zap.Error(err))
+		return nil, fmt.Errorf("productService.Search: %w", err)
+	}
+	if len(results) > 0 {
+		return &models.ProductSearchPage{Items: results, Mode: models.SearchModeFullText}, nil
+	}
+
+	results, err = p.repo.SimilarProducts(query, limit)
+	if err != nil {
+		p.logger.Error("error of searching similar products", zap.String("q", query), zap.Error(err))
+		return nil, fmt.Errorf("productService.Search: %w", err)
+	}
+	return &models.ProductSearchPage{Items: results, Mode: models.SearchModeFuzzy}, nil
 }
 
 func (p *productService) GetById(id int) (*models.Product, error) {
@@ -47,13 +129,39 @@ func (p *productService) GetById(id int) (*models.Product, error) {
 		p.logger.Error("error of getting product", zap.Int("id", id), zap.Error(err))
 		return nil, errors.New("failed to get product")
 	}
+	variants, err := p.variantRepo.GetByProduct(id)
+	if err != nil {
+		p.logger.Error("error of getting product variants", zap.Int("id", id), zap.Error(err))
+		return nil, errors.New("failed to get product")
+	}
+	product.Variants = variants
+	if err := p.images.Attach([]*models.Product{product}); err != nil {
+		return nil, errors.New("failed to get product")
+	}
 	return product, nil
 }
 
-func (p *productService) Update(product *models.Product) error {
-	if product.Name == "" || product.Price <= 0 || product.Description == "" || product.Quantity <= 0 {
-		p.logger.Warn("invalid product fields", zap.Any("product", product))
-		return errors.New("invalid product fields")
+// validateProduct holds the field rules shared by Create, Update and Import.
+func validateProduct(product *models.Product) error {
+	switch {
+	case product.Name == "":
+		return errors.New("invalid product fields: name is required")
+	case product.Description == "":
+		return errors.New("invalid product fields: description is required")
+	case product.Price <= 0:
+		return errors.New("invalid product fields: price must be positive")
+	case product.Quantity <= 0:
+		return errors.New("invalid product fields: quantity must be positive")
+	case len(product.SKU) > 64:
+		return errors.New("invalid product fields: sku is longer than 64 characters")
+	}
+	return nil
+}
+
+func (p *productService) Update(product *models.Product, actorID int) error {
+	if err := validateProduct(product); err != nil {
+		p.logger.Warn("invalid product fields", zap.Any("product", product), zap.Error(err))
+		return err
 	}
 
 	if product.ID <= 0 {
@@ -61,7 +169,10 @@ func (p *productService) Update(product *models.Product) error {
 		return errors.New("invalid product id")
 	}
 
-	err := p.repo.Update(product)
+	err := p.repo.Update(product, actorID)
+	if errors.Is(err, models.ErrProductSKUTaken) {
+		return err
+	}
 	if err != nil {
 		p.logger.Error("error of updating product", zap.Int("id", product.ID), zap.Error(err))
 		return errors.New("failed to update product")
@@ -69,12 +180,15 @@ func (p *productService) Update(product *models.Product) error {
 	return nil
 }
 
-func (p *productService) Create(product *models.Product) error {
-	if product.Name == "" || product.Price <= 0 || product.Description == "" || product.Quantity <= 0 {
-		p.logger.Warn("invalid product fields", zap.Any("product", product))
-		return errors.New("invalid product fields")
+func (p *productService) Create(product *models.Product, actorID int) error {
+	if err := validateProduct(product); err != nil {
+		p.logger.Warn("invalid product fields", zap.Any("product", product), zap.Error(err))
+		return err
+	}
+	err := p.repo.Create(product, actorID)
+	if errors.Is(err, models.ErrProductSKUTaken) {
+		return err
 	}
-	err := p.repo.Create(product)
 	if err != nil {
 		p.logger.Error("error of creating user", zap.Error(err))
 		return errors.New("failed to create user")
@@ -87,9 +201,235 @@ func (p *productService) Delete(id int) error {
 		return errors.New("invalid product id")
 	}
 	err := p.repo.Delete(id)
+	if errors.Is(err, models.ErrProductNotFound) {
+		return err
+	}
 	if err != nil {
 		p.logger.Error("error of deleting user", zap.Error(err))
 		return errors.New("failed to delete user")
 	}
 	return nil
 }
+
+func (p *productService) GetStockHistory(id int) ([]*models.StockMovement, error) {
+	if id <= 0 {
+		p.logger.Warn("invalid product id", zap.Int("id", id))
+		return nil, errors.New("invalid product id")
+	}
+	if _, err := p.repo.GetById(id); err != nil {
+		p.logger.Error("error of getting product", zap.Int("id", id), zap.Error(err))
+		return nil, models.ErrProductNotFound
+	}
+	history, err := p.repo.GetStockHistory(id)
+	if err != nil {
+		p.logger.Error("error of getting stock history", zap.Int("id", id), zap.Error(err))
+		return nil, fmt.Errorf("productService.GetStockHistory: %w", err)
+	}
+	return history, nil
+}
+
+func (p *productService) Reconcile(id int) (*models.StockReconciliation, error) {
+	if id <= 0 {
+		p.logger.Warn("invalid product id", zap.Int("id", id))
+		return nil, errors.New("invalid product id")
+	}
+	rec, err := p.repo.Reconcile(id)
+	if err != nil {
+		if errors.Is(err, models.ErrProductNotFound) {
+			return nil, err
+		}
+		p.logger.Error("error of reconciling product stock", zap.Int("id", id), zap.Error(err))
+		return nil, fmt.Errorf("productService.Reconcile: %w", err)
+	}
+	if !rec.InSync {
+		p.logger.Warn("product stock drifted from ledger", zap.Int("id", id), zap.Int("drift", rec.Drift))
+	}
+	return rec, nil
+}
+
+func (p *productService) GetVariants(productID int) ([]*models.ProductVariant, error) {
+	if productID <= 0 {
+		p.logger.Warn("invalid product id", zap.Int("id", productID))
+		return nil, errors.New("invalid product id")
+	}
+	if _, err := p.repo.GetById(productID); err != nil {
+		p.logger.Error("error of getting product", zap.Int("id", productID), zap.Error(err))
+		return nil, models.ErrProductNotFound
+	}
+	variants, err := p.variantRepo.GetByProduct(productID)
+	if err != nil {
+		p.logger.Error("error of getting product variants", zap.Int("id", productID), zap.Error(err))
+		return nil, fmt.Errorf("productService.GetVariants: %w", err)
+	}
+	return variants, nil
+}
+
+func (p *productService) CreateVariant(productID int, req *models.ProductVariantRequest, actorID int) (*models.ProductVariant, error) {
+	variant, err := p.variantFromRequest(productID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.variantRepo.Create(variant, actorID); err != nil {
+		return nil, p.variantError("error of creating product variant", err)
+	}
+	return variant, nil
+}
+
+func (p *productService) UpdateVariant(productID, variantID int, req *models.ProductVariantRequest, actorID int) (*models.ProductVariant, error) {
+	if variantID <= 0 {
+		p.logger.Warn("invalid variant id", zap.Int("id", variantID))
+		return nil, errors.New("invalid variant id")
+	}
+	variant, err := p.variantFromRequest(productID, req)
+	if err != nil {
+		return nil, err
+	}
+	variant.ID = variantID
+	if err := p.variantRepo.Update(variant, actorID); err != nil {
+		return nil, p.variantError("error of updating product variant", err)
+	}
+	return variant, nil
+}
+
+func (p *productService) DeleteVariant(productID, variantID int) error {
+	if productID <= 0 || variantID <= 0 {
+		p.logger.Warn("invalid variant id", zap.Int("product_id", productID), zap.Int("id", variantID))
+		return errors.New("invalid variant id")
+	}
+	if err := p.variantRepo.Delete(productID, variantID); err != nil {
+		return p.variantError("error of deleting product variant", err)
+	}
+	return nil
+}
+
+func (p *productService) variantFromRequest(productID int, req *models.ProductVariantRequest) (*models.ProductVariant, error) {
+	if productID <= 0 {
+		p.logger.Warn("invalid product id", zap.Int("id", productID))
+		return nil, errors.New("invalid product id")
+	}
+	sku := strings.TrimSpace(req.SKU)
+	if sku == "" || len(sku) > 64 || req.Quantity < 0 || (req.Price != nil && *req.Price < 0) {
+		p.logger.Warn("invalid variant fields", zap.Any("variant", req))
+		return nil, errors.New("invalid variant fields")
+	}
+	options := req.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+	return &models.ProductVariant{
+		ProductID: productID,
+		SKU:       sku,
+		Options:   options,
+		Price:     req.Price,
+		Quantity:  req.Quantity,
+	}, nil
+}
+
+// variantError passes domain errors through and hides everything else.
+func (p *productService) variantError(msg string, err error) error {
+	for _, domainErr := range []error{models.ErrProductNotFound, models.ErrVariantNotFound,
+		models.ErrVariantSKUTaken, models.ErrVariantInUse, models.ErrInsufficientStock} {
+		if errors.Is(err, domainErr) {
+			return err
+		}
+	}
+	p.logger.Error(msg, zap.Error(err))
+	return errors.New("failed to save product variant")
+}
+
+// Compare loads 2 to MaxCompareProducts distinct products in one query and
+// builds their comparison matrix, keeping the order in which the IDs were
+// requested. Any missing product fails the whole comparison.
+func (p *productService) Compare(ids []int) (*models.ProductComparison, error) {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			p.logger.Warn("invalid product id", zap.Int("id", id))
+			return nil, fmt.Errorf("invalid product id %d: %w", id, models.ErrInvalidFilter)
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) < 2 || len(unique) > models.MaxCompareProducts {
+		p.logger.Warn("invalid number of products to compare", zap.Ints("ids", ids))
+		return nil, fmt.Errorf("compare between 2 and %d products: %w", models.MaxCompareProducts, models.ErrInvalidFilter)
+	}
+
+	found, err := p.repo.GetByIds(unique)
+	if err != nil {
+		p.logger.Error("error of getting products to compare", zap.Ints("ids", unique), zap.Error(err))
+		return nil, fmt.Errorf("productService.Compare: %w", err)
+	}
+	byID := make(map[int]*models.Product, len(found))
+	for _, product := range found {
+		byID[product.ID] = product
+	}
+	products := make([]*models.Product, 0, len(unique))
+	for _, id := range unique {
+		product, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("product %d: %w", id, models.ErrProductNotFound)
+		}
+		products = append(products, product)
+	}
+	if err := p.images.Attach(products); err != nil {
+		return nil, fmt.Errorf("productService.Compare: %w", err)
+	}
+	return buildComparison(products), nil
+}
+
+// comparedAttributes lists the product attributes shown in a comparison.
+var comparedAttributes = []struct {
+	name  string
+	value func(*models.Product) any
+}{
+	{"name", func(p *models.Product) any { return p.Name }},
+	{"description", func(p *models.Product) any { return p.Description }},
+	{"price", func(p *models.Product) any { return p.Price }},
+	{"available", func(p *models.Product) any { return p.Available }},
+	{"in_stock", func(p *models.Product) any { return p.Available > 0 }},
+	{"created_at", func(p *models.Product) any { return p.CreatedAt }},
+}
+
+func buildComparison(products []*models.Product) *models.ProductComparison {
+	comparison := &models.ProductComparison{
+		Products:   products,
+		Attributes: make([]models.ComparisonRow, 0, len(comparedAttributes)),
+	}
+	for _, attr := range comparedAttributes {
+		row := models.ComparisonRow{Attribute: attr.name, Values: make([]any, 0, len(products))}
+		for _, product := range products {
+			value := attr.value(product)
+			if len(row.Values) > 0 && !sameValue(value, row.Values[0]) {
+				row.Differs = true
+			}
+			row.Values = append(row.Values, value)
+		}
+		comparison.Attributes = append(comparison.Attributes, row)
+	}
+
+	comparison.LowestPrice = products[0].Price
+	for _, product := range products {
+		switch {
+		case product.Price < comparison.LowestPrice:
+			comparison.LowestPrice = product.Price
+			comparison.LowestPriceIDs = []int{product.ID}
+		case product.Price == comparison.LowestPrice:
+			comparison.LowestPriceIDs = append(comparison.LowestPriceIDs, product.ID)
+		}
+	}
+	return comparison
+}
+
+// sameValue compares two attribute values. Times are compared with Equal,
+// since == also compares their location and monotonic reading.
+func sameValue(a, b any) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return a == b
+}
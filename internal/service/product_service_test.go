@@ -0,0 +1,33 @@
+package service
+
+import (
+	"mystore/internal/models"
+	"testing"
+	"time"
+)
+
+func TestBuildComparisonCreatedAt(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		second time.Time
+		differ bool
+	}{
+		{"same instant", created, false},
+		{"same instant in another location", created.In(time.FixedZone("UTC+3", 3*60*60)), false},
+		{"different instant", created.Add(time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := buildComparison([]*models.Product{
+				{ID: 1, CreatedAt: created},
+				{ID: 2, CreatedAt: tt.second},
+			})
+			for _, row := range comparison.Attributes {
+				if row.Attribute == "created_at" && row.Differs != tt.differ {
+					t.Errorf("created_at differs = %v, want %v", row.Differs, tt.differ)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RoleService manages roles and the permissions they grant. Changes reach
+// signed-in users when their access token is next refreshed.
+type RoleService interface {
+	GetAll() ([]*models.Role, error)
+	GetByName(name string) (*models.Role, error)
+	GetPermissions() ([]*models.Permission, error)
+	Create(req *models.RoleRequest) (*models.Role, error)
+	Update(name string, req *models.RoleRequest) (*models.Role, error)
+	Delete(name string) error
+}
+
+type roleService struct {
+	repo   repository.RoleRepository
+	logger *zap.Logger
+}
+
+func NewRoleService(repo repository.RoleRepository, logger *zap.Logger) RoleService {
+	return &roleService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *roleService) GetAll() ([]*models.Role, error) {
+	roles, err := s.repo.GetAll()
+	if err != nil {
+		s.logger.Error("error of getting roles", zap.Error(err))
+		return nil, fmt.Errorf("roleService.GetAll: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *roleService) GetByName(name string) (*models.Role, error) {
+	role, err := s.repo.GetByName(name)
+	if err != nil {
+		if errors.Is(err, models.ErrRoleNotFound) {
+			return nil, err
+		}
+		s.logger.Error("error of getting role", zap.String("name", name), zap.Error(err))
+		return nil, errors.New("failed to get role")
+	}
+	return role, nil
+}
+
+func (s *roleService) GetPermissions() ([]*models.Permission, error) {
+	permissions, err := s.repo.GetPermissions()
+	if err != nil {
+		s.logger.Error("error of getting permissions", zap.Error(err))
+		return nil, fmt.Errorf("roleService.GetPermissions: %w", err)
+	}
+	return permissions, nil
+}
+
+func (s *roleService) Create(req *models.RoleRequest) (*models.Role, error) {
+	role, err := s.fromRequest(req.Name, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(role); err != nil {
+		return nil, s.saveError("error of creating role", err)
+	}
+	return role, nil
+}
+
+// Update replaces the description and permissions of a role. The built-in
+// roles are refused with ErrRoleProtected.
+func (s *roleService) Update(name string, req *models.RoleRequest) (*models.Role, error) {
+	if isBuiltinRole(name) {
+		return nil, models.ErrRoleProtected
+	}
+	if req.Name != "" && req.Name != name {
+		return nil, fmt.Errorf("roles cannot be renamed: %w", models.ErrInvalidRole)
+	}
+	role, err := s.fromRequest(name, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(role); err != nil {
+		return nil, s.saveError("error of updating role", err)
+	}
+	return role, nil
+}
+
+// Delete removes a role that no user holds. The built-in roles are refused
+// with ErrRoleProtected.
+func (s *roleService) Delete(name string) error {
+	if isBuiltinRole(name) {
+		return models.ErrRoleProtected
+	}
+	if err := s.repo.Delete(name); err != nil {
+		return s.saveError("error of deleting role", err)
+	}
+	return nil
+}
+
+// fromRequest validates the role name and normalises the permission list to
+// a sorted set.
+func (s *roleService) fromRequest(name string, req *models.RoleRequest) (*models.Role, error) {
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) || len(name) > 50 {
+		s.logger.Warn("invalid role name", zap.String("name", name))
+		return nil, fmt.Errorf("role name must be lower-case letters, digits and underscores: %w", models.ErrInvalidRole)
+	}
+	seen := make(map[string]bool, len(req.Permissions))
+	permissions := make([]string, 0, len(req.Permissions))
+	for _, permission := range req.Permissions {
+		permission = strings.TrimSpace(permission)
+		if permission == "" || seen[permission] {
+			continue
+		}
+		seen[permission] = true
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return &models.Role{Name: name, Description: strings.TrimSpace(req.Description), Permissions: permissions}, nil
+}
+
+// saveError passes domain errors through and hides everything else.
+func (s *roleService) saveError(msg string, err error) error {
+	for _, domainErr := range []error{models.ErrRoleNotFound, models.ErrRoleNameTaken,
+		models.ErrRoleInUse, models.ErrUnknownPermission} {
+		if errors.Is(err, domainErr) {
+			return domainErr
+		}
+	}
+	s.logger.Error(msg, zap.Error(err))
+	return errors.New("failed to save role")
+}
+
+func isBuiltinRole(name string) bool {
+	return name == models.RoleAdmin || name == models.RoleUser
+}
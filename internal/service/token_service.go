@@ -0,0 +1,192 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"mystore/internal/auth"
+	"mystore/internal/models"
+	"mystore/internal/repository"
+	"mystore/internal/utils"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenService issues access and refresh token pairs. Refresh tokens rotate:
+// each one can be exchanged once, and presenting it a second time is taken as
+// theft, revoking its whole family along with the access tokens issued in it.
+type TokenService interface {
+	Issue(user *models.User) (*models.TokenPair, error)
+	Refresh(refreshToken string) (*models.TokenPair, error)
+	Logout(refreshToken, jti string, expiresAt time.Time) error
+}
+
+type tokenService struct {
+	repo   repository.TokenRepository
+	users  repository.UserRepository
+	roles  repository.RoleRepository
+	keys   *auth.KeyManager
+	logger *zap.Logger
+}
+
+func NewTokenService(repo repository.TokenRepository, users repository.UserRepository, roles repository.RoleRepository, keys *auth.KeyManager, logger *zap.Logger) TokenService {
+	return &tokenService{
+		repo:   repo,
+		users:  users,
+		roles:  roles,
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+// Issue starts a new token family, typically on login.
+func (s *tokenService) Issue(user *models.User) (*models.TokenPair, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		s.logger.Error("failed to generate token family", zap.Error(err))
+		return nil, errors.New("could not generate token")
+	}
+	row := &models.RefreshToken{UserID: int(user.ID), FamilyID: familyID}
+	pair, err := s.newPair(user, row)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(row); err != nil {
+		return nil, fmt.Errorf("tokenService.Issue: %w", err)
+	}
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. The access token carries
+// the user's current role and its permissions, so role changes apply from the
+// next refresh.
+func (s *tokenService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	hash := hashToken(refreshToken)
+	current, err := s.repo.GetByHash(hash)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRefreshToken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("tokenService.Refresh: %w", err)
+	}
+	if current.RevokedAt != nil || current.Expired {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	if current.UsedAt != nil {
+		return nil, s.reused(current)
+	}
+
+	user, err := s.users.GetUserById(current.UserID)
+	if err != nil {
+		s.logger.Warn("refresh token for missing user", zap.Int("user_id", current.UserID), zap.Error(err))
+		return nil, models.ErrInvalidRefreshToken
+	}
+	next := &models.RefreshToken{}
+	pair, err := s.newPair(user, next)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Rotate(hash, next); err != nil {
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			return nil, s.reused(current)
+		case errors.Is(err, models.ErrInvalidRefreshToken):
+			return nil, models.ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("tokenService.Refresh: %w", err)
+	}
+	return pair, nil
+}
+
+// reused revokes the family of a refresh token that was presented after it
+// had already been rotated.
+func (s *tokenService) reused(token *models.RefreshToken) error {
+	s.logger.Warn("refresh token reuse detected, revoking family",
+		zap.Int("user_id", token.UserID), zap.String("family_id", token.FamilyID))
+	if err := s.repo.RevokeFamily(token.FamilyID); err != nil {
+		return fmt.Errorf("tokenService.Refresh: %w", err)
+	}
+	return models.ErrRefreshTokenReused
+}
+
+// Logout revokes the refresh token's family and, when the request was
+// authenticated, the access token it carried. At least one must be given.
+func (s *tokenService) Logout(refreshToken, jti string, expiresAt time.Time) error {
+	if refreshToken == "" && jti == "" {
+		return models.ErrInvalidRefreshToken
+	}
+	if jti != "" {
+		if err := s.repo.RevokeAccessToken(jti, expiresAt); err != nil {
+			return fmt.Errorf("tokenService.Logout: %w", err)
+		}
+	}
+	if refreshToken != "" {
+		token, err := s.repo.GetByHash(hashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidRefreshToken) {
+				return err
+			}
+			return fmt.Errorf("tokenService.Logout: %w", err)
+		}
+		if err := s.repo.RevokeFamily(token.FamilyID); err != nil {
+			return fmt.Errorf("tokenService.Logout: %w", err)
+		}
+	}
+	return nil
+}
+
+// newPair signs an access token for user and generates a refresh token,
+// recording both in row.
+func (s *tokenService) newPair(user *models.User, row *models.RefreshToken) (*models.TokenPair, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		s.logger.Error("failed to generate token id", zap.Error(err))
+		return nil, errors.New("could not generate token")
+	}
+	permissions, err := s.roles.PermissionsForRole(user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("tokenService.newPair: %w", err)
+	}
+	access, err := utils.GenerateJWT(s.keys, user.ID, user.Role, permissions, jti, AccessTokenTTL)
+	if err != nil {
+		s.logger.Error("failed to generate token", zap.Error(err))
+		return nil, errors.New("could not generate token")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		s.logger.Error("failed to generate refresh token", zap.Error(err))
+		return nil, errors.New("could not generate token")
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(secret)
+
+	row.TokenHash = hashToken(refresh)
+	row.AccessJTI = jti
+	return &models.TokenPair{
+		Token:        access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// newTokenID returns 128 random bits as 32 hex characters.
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
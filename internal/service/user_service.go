@@ -6,42 +6,55 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"mystore/internal/models"
 	"mystore/internal/repository"
-	"mystore/internal/utils"
-	"strings"
 )
 
 type UserService interface {
-	CreateUser(user *models.User) error
+	CreateUser(user *models.User, canAssignRoles bool) error
 	GetAllUsers() ([]*models.User, error)
 	GetUserById(id int) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUserById(id int) error
-	Login(email, password string) (string, error)
+	UpdateUser(user *models.User, canAssignRoles bool, callerPermissions []string) error
+	DeleteUserById(id int, callerPermissions []string) error
+	Login(email, password string) (*models.TokenPair, *models.User, error)
 }
 
 type userService struct {
-	repo repository.UserRepository
-	Log  *zap.Logger
+	repo   repository.UserRepository
+	roles  repository.RoleRepository
+	tokens TokenService
+	Log    *zap.Logger
 }
 
-func NewUserService(repo repository.UserRepository, logger *zap.Logger) UserService {
+func NewUserService(repo repository.UserRepository, roles repository.RoleRepository, tokens TokenService, logger *zap.Logger) UserService {
 	return &userService{
-		repo: repo,
-		Log:  logger,
+		repo:   repo,
+		roles:  roles,
+		tokens: tokens,
+		Log:    logger,
 	}
 }
-func (s *userService) CreateUser(user *models.User) error {
-	if user.Name == "" || user.Password == "" || user.Email == "" || user.Role == "" {
+
+// CreateUser registers an account. Without a role it gets models.RoleUser;
+// any other role requires canAssignRoles and fails with ErrRoleEscalation
+// otherwise.
+func (s *userService) CreateUser(user *models.User, canAssignRoles bool) error {
+	if user.Name == "" || user.Password == "" || user.Email == "" {
 		s.Log.Error("user data is empty")
 		return errors.New("data is empty")
 	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Role != models.RoleUser && !canAssignRoles {
+		s.Log.Warn("role assignment refused", zap.String("email", user.Email), zap.String("role", user.Role))
+		return models.ErrRoleEscalation
+	}
 
 	existingUser, err := s.repo.GetUserByEmail(user.Email)
 	if err == nil && existingUser != nil {
 		s.Log.Error("user already exists", zap.String("email", user.Email))
-		return errors.New("user with this email already exists")
+		return models.ErrEmailTaken
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -110,20 +123,46 @@ func (s *userService) GetUserByEmail(email string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *userService) UpdateUser(user *models.User) error {
-
-	if user.Name == "" || user.Password == "" || user.Email == "" || user.Role == "" {
-		s.Log.Error("user data is empty")
-		return errors.New("data is empty")
-	}
-
+// UpdateUser changes the fields that are set on user and keeps the stored
+// value for the empty ones. A new password is hashed once here. Changing the
+// role requires canAssignRoles and fails with ErrRoleEscalation otherwise.
+// Accounts whose role grants permissions outside callerPermissions cannot be
+// changed and fail with ErrUserProtected. On success user holds the saved
+// account.
+func (s *userService) UpdateUser(user *models.User, canAssignRoles bool, callerPermissions []string) error {
 	if user.ID == 0 {
 		s.Log.Error("user id is empty")
 		return errors.New("user id is empty")
 	}
 
-	if !strings.HasPrefix(user.Password, "$2a$") {
-		// только если это НЕ хеш
+	current, err := s.repo.GetUserById(int(user.ID))
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			return err
+		}
+		s.Log.Error("user not found with this id", zap.Error(err))
+		return errors.New("failed to get user")
+	}
+	if err := s.checkCanManage(current, callerPermissions); err != nil {
+		return err
+	}
+
+	if user.Role != "" && user.Role != current.Role && !canAssignRoles {
+		s.Log.Warn("role change refused", zap.Int64("id", user.ID), zap.String("role", user.Role))
+		return models.ErrRoleEscalation
+	}
+	if user.Name == "" {
+		user.Name = current.Name
+	}
+	if user.Email == "" {
+		user.Email = current.Email
+	}
+	if user.Role == "" {
+		user.Role = current.Role
+	}
+	if user.Password == "" {
+		user.Password = current.Password
+	} else {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 		if err != nil {
 			s.Log.Error("failed to hash password", zap.Error(err))
@@ -131,28 +170,34 @@ func (s *userService) UpdateUser(user *models.User) error {
 		}
 		user.Password = string(hashedPassword)
 	}
+	user.CreatedAt = current.CreatedAt
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
-		s.Log.Error("failed to hash password", zap.Error(err))
-		return errors.New("failed to hash password")
-	}
-	user.Password = string(hashedPassword)
-
-	res := s.repo.UpdateUser(user)
-	if res != nil {
+	if err := s.repo.UpdateUser(user); err != nil {
 		s.Log.Error("user update failed", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (s *userService) DeleteUserById(id int) error {
+// DeleteUserById deletes an account. Like UpdateUser it refuses accounts
+// whose role grants permissions outside callerPermissions.
+func (s *userService) DeleteUserById(id int, callerPermissions []string) error {
 	if id == 0 {
 		s.Log.Error("user id is empty")
 		return errors.New("user id is empty")
 	}
-	err := s.repo.DeleteUserById(id)
+	target, err := s.repo.GetUserById(id)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			return err
+		}
+		s.Log.Error("user not found with this id", zap.Error(err))
+		return errors.New("failed to get user")
+	}
+	if err := s.checkCanManage(target, callerPermissions); err != nil {
+		return err
+	}
+	err = s.repo.DeleteUserById(id)
 	if err != nil {
 		s.Log.Error("user delete failed", zap.Error(err))
 		return err
@@ -160,21 +205,44 @@ func (s *userService) DeleteUserById(id int) error {
 	return nil
 }
 
-func (s *userService) Login(email, password string) (string, error) {
+// checkCanManage fails with ErrUserProtected unless the caller holds every
+// permission of the target's role, so nobody can take over or remove an
+// account more privileged than their own.
+func (s *userService) checkCanManage(target *models.User, callerPermissions []string) error {
+	required, err := s.roles.PermissionsForRole(target.Role)
+	if err != nil {
+		s.Log.Error("failed to get role permissions", zap.String("role", target.Role), zap.Error(err))
+		return errors.New("failed to get role permissions")
+	}
+	held := make(map[string]bool, len(callerPermissions))
+	for _, permission := range callerPermissions {
+		held[permission] = true
+	}
+	for _, permission := range required {
+		if !held[permission] {
+			s.Log.Warn("refused to manage more privileged user",
+				zap.Int64("id", target.ID), zap.String("role", target.Role), zap.String("missing", permission))
+			return models.ErrUserProtected
+		}
+	}
+	return nil
+}
+
+func (s *userService) Login(email, password string) (*models.TokenPair, *models.User, error) {
 	u, err := s.repo.GetUserByEmail(email)
 	if err != nil {
 		s.Log.Error("user not found with this email", zap.Error(err))
-		return "", errors.New("user not found with this email")
+		return nil, nil, errors.New("user not found with this email")
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil {
 		s.Log.Error("user not found with this password", zap.Error(err))
-		return "", errors.New("user not found with this password")
+		return nil, nil, errors.New("user not found with this password")
 	}
-	token, err := utils.GenerateJWT(u.ID, u.Role)
+	pair, err := s.tokens.Issue(u)
 	if err != nil {
 		s.Log.Error("failed to generate token", zap.Error(err))
-		return "", errors.New("could not generate token")
+		return nil, nil, errors.New("could not generate token")
 	}
-	return token, nil
+	return pair, u, nil
 }
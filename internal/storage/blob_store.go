@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps uploaded files such as product images. Keys are
+// slash-separated relative paths chosen by the caller. URL returns where
+// clients can read the blob: a path served by this app for local storage, or
+// a public or signed URL for object stores such as S3.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// cleanKey rejects keys that are absolute or would escape the store root.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalMediaPath is the URL path below which LocalStore blobs are served.
+const LocalMediaPath = "/media"
+
+// LocalStore keeps blobs on the local filesystem under root. It also serves
+// them over HTTP below LocalMediaPath, which is where URL points.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("storage.NewLocalStore: %w", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put writes the blob to a temporary file first and renames it into place, so
+// readers never see a partially written file.
+func (s *LocalStore) Put(_ context.Context, key string, r io.Reader, _ string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("storage.LocalStore.Put: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage.LocalStore.Put: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("storage.LocalStore.Put: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("storage.LocalStore.Put: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("storage.LocalStore.Put: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the blob; deleting a missing blob is not an error.
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(s.root, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage.LocalStore.Delete: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return LocalMediaPath + "/" + key
+}
+
+// ServeHTTP serves the blob named by the request path below LocalMediaPath.
+// Directories are never listed.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := cleanKey(strings.TrimPrefix(r.URL.Path, LocalMediaPath+"/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -2,18 +2,22 @@ package utils
 
 import (
 	"github.com/golang-jwt/jwt/v5"
-	"os"
+	"mystore/internal/auth"
 	"time"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_KEY"))
-
-func GenerateJWT(userID int64, role string) (string, error) {
+// GenerateJWT signs an access token valid for ttl with the current signing
+// key. The token carries the permissions of the user's role; jti identifies
+// the token so it can be revoked before it expires.
+func GenerateJWT(keys *auth.KeyManager, userID int64, role string, permissions []string, jti string, ttl time.Duration) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"user_id":     userID,
+		"role":        role,
+		"permissions": permissions,
+		"jti":         jti,
+		"iat":         now.Unix(),
+		"exp":         now.Add(ttl).Unix(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return keys.Sign(claims)
 }